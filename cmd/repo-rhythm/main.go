@@ -2,12 +2,19 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/dannykopping/repo-rhythm/pkg/beats"
+	"github.com/dannykopping/repo-rhythm/pkg/discovery"
 	repo_rhythm "github.com/dannykopping/repo-rhythm/pkg/rhythm"
+	"github.com/dannykopping/repo-rhythm/pkg/runner"
+	"github.com/dannykopping/repo-rhythm/pkg/store"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/shurcooL/githubv4"
@@ -18,28 +25,28 @@ import (
 )
 
 func main() {
-	// TODO: externally configurable
-	cfg := &repo_rhythm.Config{
-		Owner:           "grafana",
-		Repo:            "loki",
-		TimeoutDuration: 10 * time.Second,
-		TickInterval:    time.Minute,
-	}
-
 	w := log.NewSyncWriter(os.Stderr)
 	logger := log.NewLogfmtLogger(w)
 
-	list := []beats.Beat{
-		&beats.Count{},
-		&beats.OpenIssueAge{},
-		&beats.OpenPullRequestAge{},
-		&beats.ClosedIssueLifecycle{},
+	cfg, err := repo_rhythm.Load(os.Args[0], os.Args[1:], beats.Names())
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if err != nil {
+		level.Error(logger).Log("msg", "failed to load config", "err", err)
+		os.Exit(1)
+	}
+
+	names := cfg.Beats
+	if len(names) == 0 {
+		names = beats.Names()
 	}
 
 	src := oauth2.StaticTokenSource(
-		&oauth2.Token{AccessToken: os.Getenv("GITHUB_TOKEN")},
+		&oauth2.Token{AccessToken: cfg.Token},
 	)
 	httpClient := oauth2.NewClient(context.Background(), src)
+	httpClient.Transport = beats.NewTransport(httpClient.Transport)
 	client := githubv4.NewClient(httpClient)
 
 	exec := beats.NewExecutor(cfg, client, log.With(logger, "component", "executor"))
@@ -47,37 +54,135 @@ func main() {
 	gatherer := prometheus.NewPedanticRegistry()
 	reg := prometheus.WrapRegistererWithPrefix("repo_rhythm_", gatherer)
 
-	for _, beat := range list {
-		beat.Setup(cfg, exec)
-		reg.MustRegister(beat)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var st *store.Store
+	if cfg.Store.Path != "" {
+		st, err = store.Open(cfg.Store.Path)
+		if err != nil {
+			level.Error(logger).Log("msg", "failed to open store", "err", err)
+			os.Exit(1)
+		}
+		defer st.Close()
+
+		if cfg.Store.Wipe {
+			if err := st.Wipe(); err != nil {
+				level.Error(logger).Log("msg", "failed to wipe store", "err", err)
+				os.Exit(1)
+			}
+			level.Info(logger).Log("msg", "wiped store", "path", cfg.Store.Path)
+		}
+	}
 
-		go func(beat beats.Beat) {
-			tick := time.NewTicker(cfg.TickInterval)
-			defer tick.Stop()
+	run := runner.New(cfg, names, exec, st, reg, logger)
 
-			// tick immediately
-			for ; true; <-tick.C {
-				start := time.Now()
+	discovered := make(chan struct{})
+	if len(cfg.Discovery.Owners) == 0 {
+		close(discovered)
 
-				log := log.With(logger, "beat", beat.Name(), "interval", cfg.TickInterval)
-				level.Info(log).Log("msg", "beat finished", "start", start)
+		if err := run.Sync(ctx, cfg.Repositories); err != nil {
+			level.Error(logger).Log("msg", "failed to start beats", "err", err)
+			os.Exit(1)
+		}
+	} else {
+		discoverer := discovery.NewDiscoverer(&cfg.Discovery, exec, log.With(logger, "component", "discovery"))
 
-				err := beat.Tick(log)
+		go func() {
+			defer close(discovered)
 
+			tick := time.NewTicker(cfg.Discovery.Interval)
+			defer tick.Stop()
+
+			// nothing discovered is monitored until the first discovery succeeds, so it is retried with backoff
+			// rather than at the next interval
+			var (
+				initial = true
+				attempt = 1
+				backoff = cfg.Retry.MinBackoff
+			)
+
+			// discover immediately
+			for {
+				found, err := discoverer.Discover(ctx)
+				if ctx.Err() != nil {
+					return
+				}
 				if err != nil {
-					level.Warn(log).Log("msg", "beat failed", "err", err, start, "duration", time.Since(start))
-					continue
+					level.Warn(logger).Log("msg", "repository discovery failed; using previous result", "err", err)
 				}
 
-				level.Warn(log).Log("msg", "beat succeeded", start, "duration", time.Since(start))
+				if err := run.Sync(ctx, append(found, cfg.Repositories...)); err != nil {
+					if initial {
+						level.Error(logger).Log("msg", "failed to start beats", "err", err)
+					} else {
+						level.Warn(logger).Log("msg", "failed to start beats", "err", err)
+					}
+				}
+
+				next := tick.C
+				if initial && err != nil && attempt < cfg.Retry.MaxAttempts {
+					level.Info(logger).Log("msg", "retrying initial repository discovery", "attempt", attempt, "delay", backoff)
+					next = time.After(backoff)
+
+					attempt++
+					if backoff *= 2; backoff > cfg.Retry.MaxBackoff {
+						backoff = cfg.Retry.MaxBackoff
+					}
+				} else {
+					initial = false
+				}
+
+				select {
+				case <-ctx.Done():
+					return
+				case <-next:
+				}
 			}
-		}(beat)
+		}()
 	}
 
-	http.Handle("/metrics", promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{
 		ErrorHandling: promhttp.HTTPErrorOnError,
 	}))
 
-	// TODO listen on all addresses
-	level.Error(logger).Log("msg", "/metrics handler stopped", "err", http.ListenAndServe("127.0.0.1:9123", nil))
+	srv := &http.Server{
+		Addr:    cfg.ListenAddress,
+		Handler: mux,
+	}
+
+	go func() {
+		level.Info(logger).Log("msg", "listening", "addr", cfg.ListenAddress)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			level.Error(logger).Log("msg", "/metrics handler stopped", "err", err)
+			stop()
+		}
+	}()
+
+	<-ctx.Done()
+	level.Info(logger).Log("msg", "shutting down")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+
+	// beats keep being served until they have stopped, so that their final state can still be scraped
+	drained := make(chan struct{})
+	go func() {
+		<-discovered
+		run.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		level.Info(logger).Log("msg", "beats stopped")
+	case <-shutdownCtx.Done():
+		level.Warn(logger).Log("msg", "timed out waiting for beats to stop")
+	}
+
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		level.Error(logger).Log("msg", "failed to shut down /metrics handler", "err", err)
+		os.Exit(1)
+	}
 }
@@ -0,0 +1,151 @@
+package beats
+
+import (
+	"context"
+	"time"
+
+	"github.com/dannykopping/repo-rhythm/pkg/metrics"
+	"github.com/dannykopping/repo-rhythm/pkg/rhythm"
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/shurcooL/githubv4"
+)
+
+// Assignees measures the workload of each assignee: the number of open issues and pull requests assigned to them, and
+// how long they have been assigned. It also counts the open issues which aren't assigned to anyone.
+//
+// To bound cardinality, only the assignees in the configured allowlist, or failing that those with the most open
+// assignments, are labelled individually; the rest are aggregated as "other".
+type Assignees struct {
+	cfg   *rhythm.Config
+	repo  rhythm.Repository
+	exec  *Executor
+	cache *Cache
+
+	assigned   metrics.GaugeVec
+	age        metrics.Distribution
+	unassigned prometheus.Gauge
+}
+
+func (o *Assignees) Name() string {
+	return "assignees"
+}
+
+func (o *Assignees) Setup(cfg *rhythm.Config, target *Target) {
+	o.cfg = cfg
+	o.repo = target.Repository
+	o.exec = target.Exec
+	o.cache = target.Cache
+
+	constLabels := map[string]string{
+		"owner": target.Owner,
+		"repo":  target.Repo,
+	}
+
+	o.assigned = metrics.NewGaugeVec(prometheus.GaugeOpts{
+		Name:        "assigned",
+		Help:        "Current number of open issues and pull requests assigned to each assignee",
+		ConstLabels: constLabels,
+	}, []string{"assignee", "kind"})
+	o.age = metrics.NewDistribution(
+		metrics.DistributionOpts{
+			Name:           "assignment_age",
+			Help:           "Distribution of time since open issues and pull requests were assigned to each assignee by days",
+			ConstLabels:    constLabels,
+			VariableLabels: []string{"assignee", "kind"},
+			Cumulative:     cfg.CumulativeDistributions,
+		},
+		CreateDayBuckets(),
+	)
+	o.unassigned = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name:        "unassigned_issues",
+		Help:        "Current number of open issues which aren't assigned to anyone",
+		ConstLabels: constLabels,
+	})
+}
+
+func (o *Assignees) Tick(ctx context.Context, logger log.Logger) error {
+	if err := o.cache.Sync(ctx, logger); err != nil {
+		return err
+	}
+
+	var (
+		now = time.Now()
+
+		// assignments holds the open assignments of each kind, by assignee
+		assignments = make(map[string]map[string][]Assignment)
+		counts      = make(map[string]int)
+		unassigned  float64
+	)
+
+	record := func(kind string, assignees []Assignment) {
+		for _, a := range assignees {
+			if assignments[a.Login] == nil {
+				assignments[a.Login] = make(map[string][]Assignment)
+			}
+			assignments[a.Login][kind] = append(assignments[a.Login][kind], a)
+			counts[a.Login]++
+		}
+	}
+
+	for _, issue := range o.cache.Issues() {
+		if issue.State != githubv4.IssueStateOpen {
+			continue
+		}
+
+		if len(issue.Assignees) == 0 {
+			unassigned++
+		}
+		record(kindIssue, issue.Assignees)
+	}
+	for _, pr := range o.cache.PullRequests() {
+		if pr.State == githubv4.PullRequestStateOpen {
+			record(kindPullRequest, pr.Assignees)
+		}
+	}
+
+	labelled := topN(counts, o.cfg.Assignees.TopN)
+	if len(o.cfg.Assignees.Allowlist) > 0 {
+		labelled = make(map[string]struct{}, len(o.cfg.Assignees.Allowlist))
+		for _, login := range o.cfg.Assignees.Allowlist {
+			labelled[login] = struct{}{}
+		}
+	}
+
+	var (
+		age      = o.age.NewSnapshot()
+		assigned = o.assigned.NewSnapshot()
+	)
+
+	for login, byKind := range assignments {
+		if _, ok := labelled[login]; !ok {
+			login = otherLabel
+		}
+
+		for kind, as := range byKind {
+			for _, a := range as {
+				hours := now.Sub(a.AssignedAt)
+				age.Observe(hours.Hours(), login, kind)
+			}
+			assigned.Add(float64(len(as)), login, kind)
+		}
+	}
+
+	o.age.Swap(age)
+	o.assigned.Swap(assigned)
+	o.unassigned.Set(unassigned)
+
+	return nil
+}
+
+func (o *Assignees) Collect(ch chan<- prometheus.Metric) {
+	o.assigned.Collect(ch)
+	o.age.Collect(ch)
+	o.unassigned.Collect(ch)
+}
+
+func (o *Assignees) Describe(ch chan<- *prometheus.Desc) {
+	o.assigned.Describe(ch)
+	o.age.Describe(ch)
+	o.unassigned.Describe(ch)
+}
@@ -0,0 +1,117 @@
+package beats
+
+import (
+	"sync"
+	"time"
+)
+
+// budget tracks the GraphQL rate limit, which is shared by all queries made with the same token.
+// Points are reserved before each query is executed, and the budget is corrected from the rate limit
+// status returned with each query.
+type budget struct {
+	reserve int
+
+	mu        sync.Mutex
+	known     bool
+	remaining int
+	resetAt   time.Time
+	// cost is the highest cost of any query seen so far, which is used to estimate the cost of the next query
+	cost int
+	// pausedUntil holds back all queries, e.g. after a secondary rate limit was hit
+	pausedUntil time.Time
+	// lastReset is the reset time from the X-RateLimit-Reset header of the most recent response, which is recorded
+	// even for failed queries whose rate limit status is unavailable
+	lastReset time.Time
+}
+
+func newBudget(reserve int) *budget {
+	return &budget{
+		reserve: reserve,
+		cost:    1,
+	}
+}
+
+// acquire reserves points for a query, returning how long to wait until the rate limit resets
+// if there are not enough points remaining. Nothing is reserved if a wait is required.
+func (b *budget) acquire(now time.Time) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if now.Before(b.pausedUntil) {
+		return b.pausedUntil.Sub(now)
+	}
+
+	if !b.known || !now.Before(b.resetAt) {
+		// either nothing is known about the rate limit yet or it has since been reset
+		return 0
+	}
+
+	if b.remaining-b.cost < b.reserve {
+		return b.resetAt.Sub(now)
+	}
+
+	b.remaining -= b.cost
+	return 0
+}
+
+// update corrects the budget using the rate limit status returned with a query.
+func (b *budget) update(rl RateLimit) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if rl.Cost > b.cost {
+		b.cost = rl.Cost
+	}
+
+	resetAt := rl.ResetAt.Time
+	switch {
+	case !b.known, resetAt.After(b.resetAt):
+		// first status seen, or the first of a new window
+		b.remaining = rl.Remaining
+	case resetAt.Equal(b.resetAt) && rl.Remaining < b.remaining:
+		// responses to concurrent queries can arrive out of order; the lowest count is the most recent
+		b.remaining = rl.Remaining
+	default:
+		// stale status from a previous window
+		return
+	}
+
+	b.known = true
+	b.resetAt = resetAt
+}
+
+// pause holds back all queries until the given time.
+func (b *budget) pause(until time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if until.After(b.pausedUntil) {
+		b.pausedUntil = until
+	}
+}
+
+// recordReset records the reset time given by the headers of a response.
+func (b *budget) recordReset(resetAt time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.lastReset = resetAt
+}
+
+// retryAfter returns how long until the most recently recorded reset time, or 0 if it has passed.
+func (b *budget) retryAfter(now time.Time) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !now.Before(b.lastReset) {
+		return 0
+	}
+	return b.lastReset.Sub(now)
+}
+
+func (b *budget) status() (remaining int, resetAt time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.remaining, b.resetAt
+}
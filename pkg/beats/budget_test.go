@@ -0,0 +1,145 @@
+package beats
+
+import (
+	"testing"
+	"time"
+
+	"github.com/shurcooL/githubv4"
+)
+
+func rateLimit(cost, remaining int, resetAt time.Time) RateLimit {
+	return RateLimit{Cost: cost, Remaining: remaining, ResetAt: githubv4.DateTime{Time: resetAt}, Limit: 5000}
+}
+
+func TestBudgetUnknown(t *testing.T) {
+	b := newBudget(100)
+
+	// nothing is held back until the rate limit status is known
+	for i := 0; i < 10; i++ {
+		if delay := b.acquire(testNow); delay != 0 {
+			t.Fatalf("expected no delay, got %s", delay)
+		}
+	}
+}
+
+func TestBudgetReserve(t *testing.T) {
+	now := testNow
+	resetAt := now.Add(30 * time.Minute)
+
+	b := newBudget(100)
+	b.update(rateLimit(2, 106, resetAt))
+
+	// points are reserved at the highest cost seen, until the reserve would be breached
+	for i := 0; i < 3; i++ {
+		if delay := b.acquire(now); delay != 0 {
+			t.Fatalf("acquire %d: expected no delay, got %s", i, delay)
+		}
+	}
+	if remaining, _ := b.status(); remaining != 100 {
+		t.Fatalf("expected 100 points remaining, got %d", remaining)
+	}
+
+	now = now.Add(10 * time.Minute)
+	if delay := b.acquire(now); delay != 20*time.Minute {
+		t.Fatalf("expected to wait 20m for the reset, got %s", delay)
+	}
+	if remaining, _ := b.status(); remaining != 100 {
+		t.Fatalf("expected nothing to be reserved while waiting, got %d remaining", remaining)
+	}
+
+	// once the window has reset, queries are allowed again until a new status is seen
+	now = resetAt
+	if delay := b.acquire(now); delay != 0 {
+		t.Fatalf("expected no delay after the reset, got %s", delay)
+	}
+}
+
+func TestBudgetUpdate(t *testing.T) {
+	resetAt := testNow.Add(time.Hour)
+
+	tests := []struct {
+		name          string
+		updates       []RateLimit
+		wantRemaining int
+		wantResetAt   time.Time
+	}{
+		{
+			name:          "first status",
+			updates:       []RateLimit{rateLimit(1, 4000, resetAt)},
+			wantRemaining: 4000,
+			wantResetAt:   resetAt,
+		},
+		{
+			name:          "lowest remaining wins within a window",
+			updates:       []RateLimit{rateLimit(1, 3990, resetAt), rateLimit(1, 3995, resetAt)},
+			wantRemaining: 3990,
+			wantResetAt:   resetAt,
+		},
+		{
+			name:          "new window",
+			updates:       []RateLimit{rateLimit(1, 10, resetAt), rateLimit(1, 4999, resetAt.Add(time.Hour))},
+			wantRemaining: 4999,
+			wantResetAt:   resetAt.Add(time.Hour),
+		},
+		{
+			name:          "stale window",
+			updates:       []RateLimit{rateLimit(1, 4999, resetAt.Add(time.Hour)), rateLimit(1, 10, resetAt)},
+			wantRemaining: 4999,
+			wantResetAt:   resetAt.Add(time.Hour),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newBudget(0)
+			for _, rl := range tt.updates {
+				b.update(rl)
+			}
+
+			remaining, resetAt := b.status()
+			if remaining != tt.wantRemaining {
+				t.Errorf("expected %d remaining, got %d", tt.wantRemaining, remaining)
+			}
+			if !resetAt.Equal(tt.wantResetAt) {
+				t.Errorf("expected reset at %s, got %s", tt.wantResetAt, resetAt)
+			}
+		})
+	}
+}
+
+func TestBudgetCost(t *testing.T) {
+	b := newBudget(0)
+	b.update(rateLimit(1, 50, testNow.Add(time.Hour)))
+	b.update(rateLimit(40, 49, testNow.Add(time.Hour)))
+
+	// the next query is assumed to cost as much as the most expensive one so far
+	if delay := b.acquire(testNow); delay != 0 {
+		t.Fatalf("expected no delay, got %s", delay)
+	}
+	if delay := b.acquire(testNow); delay != time.Hour {
+		t.Fatalf("expected to wait 1h for the reset, got %s", delay)
+	}
+}
+
+func TestBudgetPause(t *testing.T) {
+	now := testNow
+	b := newBudget(0)
+
+	b.pause(now.Add(time.Minute))
+	// an earlier pause does not shorten a later one
+	b.pause(now.Add(time.Second))
+
+	if delay := b.acquire(now); delay != time.Minute {
+		t.Fatalf("expected to wait 1m, got %s", delay)
+	}
+
+	now = now.Add(45 * time.Second)
+	if delay := b.acquire(now); delay != 15*time.Second {
+		t.Fatalf("expected to wait 15s, got %s", delay)
+	}
+
+	now = now.Add(15 * time.Second)
+	if delay := b.acquire(now); delay != 0 {
+		t.Fatalf("expected no delay once the pause is over, got %s", delay)
+	}
+}
@@ -0,0 +1,867 @@
+package beats
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/dannykopping/repo-rhythm/pkg/rhythm"
+	"github.com/dannykopping/repo-rhythm/pkg/store"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/shurcooL/githubv4"
+)
+
+// Issue is the cached state of an issue.
+type Issue struct {
+	Number    int
+	State     githubv4.IssueState
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	// ClosedAt is zero if the issue has never been closed.
+	ClosedAt time.Time
+	Author   Actor
+	// AuthorAssociation is the author's association with the repository as of the last update.
+	AuthorAssociation githubv4.CommentAuthorAssociation
+	Labels            []string
+	// RecentComments are the latest few comments, oldest first.
+	RecentComments []Comment
+	Assignees      []Assignment
+}
+
+// PullRequest is the cached state of a pull request.
+type PullRequest struct {
+	Number    int
+	State     githubv4.PullRequestState
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	// ClosedAt is zero if the pull request has never been closed.
+	ClosedAt time.Time
+	// MergedAt is zero if the pull request has not been merged.
+	MergedAt    time.Time
+	BaseRefName string
+	Author      Actor
+	// AuthorAssociation is the author's association with the repository as of the last update.
+	AuthorAssociation githubv4.CommentAuthorAssociation
+	Labels            []string
+	// RecentComments are the latest few comments, oldest first.
+	RecentComments []Comment
+	Assignees      []Assignment
+	// RecentReviews are the latest few submitted reviews, oldest first.
+	RecentReviews []Review
+
+	Additions    int
+	Deletions    int
+	ChangedFiles int
+	Commits      int
+}
+
+// Actor is the author of an issue, pull request, comment or review.
+type Actor struct {
+	Login string
+	// IsBot is set if the actor is a GitHub App; see also rhythm.Config.IsBot.
+	IsBot bool
+}
+
+// Comment is a comment on an issue or pull request.
+type Comment struct {
+	Author    Actor
+	CreatedAt time.Time
+}
+
+// Review is a submitted review of a pull request.
+type Review struct {
+	Author            Actor
+	AuthorAssociation githubv4.CommentAuthorAssociation
+	SubmittedAt       time.Time
+}
+
+// Assignment is the assignment of an issue or pull request to a user.
+type Assignment struct {
+	Login string
+	// AssignedAt is when the user was last assigned, or when the issue or pull request was created if that isn't known.
+	AssignedAt time.Time
+}
+
+// recentComments is the number of latest comments cached for each issue and pull request, as fetched by the
+// comments(last:5) connections below.
+const recentComments = 5
+
+// cacheVersion must be incremented whenever the cached fields change, so that persisted caches are resynced.
+const cacheVersion = 8
+
+// Buckets and keys under which the cache is persisted.
+const (
+	issuesBucket       = "issues"
+	pullRequestsBucket = "pull_requests"
+	syncBucket         = "sync"
+
+	versionKey  = "version"
+	lastSyncKey = "last_sync"
+)
+
+// Cache holds the issues and pull requests of a repository, which are shared by all of its beats.
+//
+// The cache is populated in full on the first sync, after which only the issues and pull requests which were
+// updated since the previous sync are fetched. Both are fetched in descending order of last update, so a sync
+// can stop as soon as it reaches an issue or pull request which was already up to date, and a sync which is
+// interrupted resumes from where it left off.
+//
+// Issues and pull requests which are deleted, or issues which are transferred to another repository, are never
+// fetched by a sync. So that they don't remain open in the cache forever, each sync compares the number of open
+// issues and pull requests in the cache with those in the repository and, if they differ, removes those which are
+// no longer open; any which were closed rather than removed are fetched again by the next sync.
+//
+// If a store is given, the cache is persisted page by page along with its sync progress, and is restored from the
+// store on the first sync after a restart.
+type Cache struct {
+	cfg   *rhythm.Config
+	repo  rhythm.Repository
+	exec  *Executor
+	store *store.Store
+
+	// syncMu serialises syncs, so that beats ticking at the same time share a single sync
+	syncMu      sync.Mutex
+	loaded      bool
+	lastSync    time.Time
+	issueSync   syncState
+	pullReqSync syncState
+
+	mu           sync.RWMutex
+	issues       map[int]Issue
+	pullRequests map[int]PullRequest
+}
+
+// syncState tracks the progress of syncing a single connection, i.e. issues or pull requests.
+type syncState struct {
+	// Watermark is the latest update time of any node, as of the last completed sync.
+	Watermark time.Time
+	// Cursor is where an interrupted sync resumes from; nil if the last sync completed.
+	Cursor *githubv4.String
+	// PendingWatermark is the latest update time of any node seen by the sync in progress,
+	// which becomes the watermark once it completes.
+	PendingWatermark time.Time
+}
+
+// page is a single page of nodes fetched from a connection.
+type page[T any] struct {
+	nodes       []T
+	updatedAt   func(T) time.Time
+	endCursor   githubv4.String
+	hasNextPage bool
+}
+
+// NewCache creates a Cache for the given repository. The store may be nil, in which case nothing is persisted.
+func NewCache(cfg *rhythm.Config, repo rhythm.Repository, exec *Executor, st *store.Store) *Cache {
+	return &Cache{
+		cfg:          cfg,
+		repo:         repo,
+		exec:         exec,
+		store:        st,
+		issues:       make(map[int]Issue),
+		pullRequests: make(map[int]PullRequest),
+	}
+}
+
+// Sync fetches the issues and pull requests which have been updated since the last sync.
+// It does nothing if the cache was synced within the configured minimum sync interval.
+func (c *Cache) Sync(ctx context.Context, logger log.Logger) error {
+	c.syncMu.Lock()
+	defer c.syncMu.Unlock()
+
+	if !c.loaded {
+		if err := c.load(logger); err != nil {
+			return err
+		}
+		c.loaded = true
+	}
+
+	if time.Since(c.lastSync) < c.cfg.Sync.MinInterval {
+		return nil
+	}
+
+	start := time.Now()
+
+	issues, err := syncConnection(ctx, &c.issueSync, c.fetchIssues, func(issues []Issue, state syncState) error {
+		c.mu.Lock()
+		for _, issue := range issues {
+			c.issues[issue.Number] = issue
+		}
+		c.mu.Unlock()
+
+		records := []store.Record{{Bucket: syncBucket, Key: issuesBucket, Value: state}}
+		for _, issue := range issues {
+			records = append(records, store.Record{Bucket: issuesBucket, Key: strconv.Itoa(issue.Number), Value: issue})
+		}
+		return c.save(records...)
+	})
+	if err != nil {
+		return err
+	}
+
+	pullRequests, err := syncConnection(ctx, &c.pullReqSync, c.fetchPullRequests, func(pullRequests []PullRequest, state syncState) error {
+		c.mu.Lock()
+		for _, pr := range pullRequests {
+			c.pullRequests[pr.Number] = pr
+		}
+		c.mu.Unlock()
+
+		records := []store.Record{{Bucket: syncBucket, Key: pullRequestsBucket, Value: state}}
+		for _, pr := range pullRequests {
+			records = append(records, store.Record{Bucket: pullRequestsBucket, Key: strconv.Itoa(pr.Number), Value: pr})
+		}
+		return c.save(records...)
+	})
+	if err != nil {
+		return err
+	}
+
+	removedIssues, removedPullRequests, err := c.reconcile(ctx)
+	if err != nil {
+		return err
+	}
+
+	c.lastSync = start
+	if err := c.save(store.Record{Bucket: syncBucket, Key: lastSyncKey, Value: start}); err != nil {
+		return err
+	}
+
+	level.Debug(logger).Log("msg", "cache synced", "issues_updated", issues, "pull_requests_updated", pullRequests,
+		"issues_removed", removedIssues, "pull_requests_removed", removedPullRequests, "duration", time.Since(start))
+
+	return nil
+}
+
+// load restores the cache from the store, if there is one. A cache persisted with a different version is
+// discarded, so that it is fetched again in full.
+func (c *Cache) load(logger log.Logger) error {
+	if c.store == nil {
+		return nil
+	}
+
+	var version int
+	err := c.store.Get(c.repo, syncBucket, versionKey, &version)
+	if err != nil && !errors.Is(err, store.NotFoundErr) {
+		return fmt.Errorf("failed to load cache: %w", err)
+	}
+
+	if version != cacheVersion {
+		if version != 0 {
+			level.Info(logger).Log("msg", "discarding persisted cache from a different version", "version", version, "expected", cacheVersion)
+		}
+
+		if err := c.store.Delete(c.repo); err != nil {
+			return fmt.Errorf("failed to discard cache: %w", err)
+		}
+		return c.save(store.Record{Bucket: syncBucket, Key: versionKey, Value: cacheVersion})
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	err = errors.Join(
+		c.store.ForEach(c.repo, issuesBucket, func(_ string, val []byte) error {
+			var issue Issue
+			if err := json.Unmarshal(val, &issue); err != nil {
+				return err
+			}
+			c.issues[issue.Number] = issue
+			return nil
+		}),
+		c.store.ForEach(c.repo, pullRequestsBucket, func(_ string, val []byte) error {
+			var pr PullRequest
+			if err := json.Unmarshal(val, &pr); err != nil {
+				return err
+			}
+			c.pullRequests[pr.Number] = pr
+			return nil
+		}),
+		ignoreNotFound(c.store.Get(c.repo, syncBucket, issuesBucket, &c.issueSync)),
+		ignoreNotFound(c.store.Get(c.repo, syncBucket, pullRequestsBucket, &c.pullReqSync)),
+		ignoreNotFound(c.store.Get(c.repo, syncBucket, lastSyncKey, &c.lastSync)),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to load cache: %w", err)
+	}
+
+	level.Debug(logger).Log("msg", "cache loaded", "issues", len(c.issues), "pull_requests", len(c.pullRequests), "last_sync", c.lastSync)
+	return nil
+}
+
+// reconcile removes the issues and pull requests which are open in the cache but not in the repository, if the
+// number of them differs. It returns the number of issues and pull requests removed.
+func (c *Cache) reconcile(ctx context.Context) (int, int, error) {
+	var query struct {
+		Base
+
+		Repository struct {
+			Issues struct {
+				TotalCount int
+			} `graphql:"issues(states:[OPEN])"`
+			PullRequests struct {
+				TotalCount int
+			} `graphql:"pullRequests(states:[OPEN])"`
+		} `graphql:"repository(name:$repo, owner:$owner)"`
+	}
+
+	err := c.exec.Execute(ctx, &query, map[string]interface{}{
+		"owner": githubv4.String(c.repo.Owner),
+		"repo":  githubv4.String(c.repo.Repo),
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var issues, pullRequests []int
+
+	c.mu.RLock()
+	openIssues := countOpen(c.issues, func(issue Issue) bool { return issue.State == githubv4.IssueStateOpen })
+	openPullRequests := countOpen(c.pullRequests, func(pr PullRequest) bool { return pr.State == githubv4.PullRequestStateOpen })
+	c.mu.RUnlock()
+
+	if openIssues != query.Repository.Issues.TotalCount {
+		open, err := fetchNumbers(ctx, c.fetchOpenIssueNumbers)
+		if err != nil {
+			return 0, 0, err
+		}
+
+		c.mu.Lock()
+		issues = prune(c.issues, open, func(issue Issue) bool { return issue.State == githubv4.IssueStateOpen })
+		c.mu.Unlock()
+	}
+
+	if openPullRequests != query.Repository.PullRequests.TotalCount {
+		open, err := fetchNumbers(ctx, c.fetchOpenPullRequestNumbers)
+		if err != nil {
+			return 0, 0, err
+		}
+
+		c.mu.Lock()
+		pullRequests = prune(c.pullRequests, open, func(pr PullRequest) bool { return pr.State == githubv4.PullRequestStateOpen })
+		c.mu.Unlock()
+	}
+
+	if c.store != nil && len(issues)+len(pullRequests) > 0 {
+		err := errors.Join(
+			c.store.DeleteKeys(c.repo, issuesBucket, keys(issues)...),
+			c.store.DeleteKeys(c.repo, pullRequestsBucket, keys(pullRequests)...),
+		)
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to persist cache: %w", err)
+		}
+	}
+
+	return len(issues), len(pullRequests), nil
+}
+
+// countOpen returns the number of cached issues or pull requests which are open.
+func countOpen[T any](nodes map[int]T, open func(T) bool) int {
+	var count int
+	for _, node := range nodes {
+		if open(node) {
+			count++
+		}
+	}
+	return count
+}
+
+// prune removes the cached issues or pull requests which are open, but whose numbers are not in the given set of
+// numbers open in the repository. It returns the numbers of those removed.
+func prune[T any](nodes map[int]T, open map[int]struct{}, isOpen func(T) bool) []int {
+	var removed []int
+	for number, node := range nodes {
+		if _, ok := open[number]; ok || !isOpen(node) {
+			continue
+		}
+
+		delete(nodes, number)
+		removed = append(removed, number)
+	}
+	return removed
+}
+
+func keys(numbers []int) []string {
+	keys := make([]string, 0, len(numbers))
+	for _, number := range numbers {
+		keys = append(keys, strconv.Itoa(number))
+	}
+	return keys
+}
+
+func (c *Cache) save(records ...store.Record) error {
+	if c.store == nil {
+		return nil
+	}
+
+	if err := c.store.Save(c.repo, records...); err != nil {
+		return fmt.Errorf("failed to persist cache: %w", err)
+	}
+	return nil
+}
+
+// loadDerived restores the values derived by a beat from issues or pull requests, keyed by number, which were saved
+// under the given bucket with saveDerived. Nothing is restored if there is no store.
+func loadDerived[T any](c *Cache, bucket string) (map[int]T, error) {
+	values := make(map[int]T)
+	if c.store == nil {
+		return values, nil
+	}
+
+	err := c.store.ForEach(c.repo, bucket, func(key string, val []byte) error {
+		number, err := strconv.Atoi(key)
+		if err != nil {
+			return err
+		}
+
+		var v T
+		if err := json.Unmarshal(val, &v); err != nil {
+			return err
+		}
+		values[number] = v
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load %s: %w", bucket, err)
+	}
+	return values, nil
+}
+
+// saveDerived persists a value derived by a beat from an issue or pull request alongside the cache, so that it
+// needn't be derived again after a restart. Derived values are discarded along with the cache if its version changes.
+func (c *Cache) saveDerived(bucket string, number int, v interface{}) error {
+	return c.save(store.Record{Bucket: bucket, Key: strconv.Itoa(number), Value: v})
+}
+
+// deleteDerived removes the values derived by a beat from the given issues or pull requests.
+func (c *Cache) deleteDerived(bucket string, numbers []int) error {
+	if c.store == nil || len(numbers) == 0 {
+		return nil
+	}
+
+	if err := c.store.DeleteKeys(c.repo, bucket, keys(numbers)...); err != nil {
+		return fmt.Errorf("failed to persist cache: %w", err)
+	}
+	return nil
+}
+
+func ignoreNotFound(err error) error {
+	if errors.Is(err, store.NotFoundErr) {
+		return nil
+	}
+	return err
+}
+
+// Issues returns a snapshot of all cached issues.
+func (c *Cache) Issues() []Issue {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	issues := make([]Issue, 0, len(c.issues))
+	for _, issue := range c.issues {
+		issues = append(issues, issue)
+	}
+	return issues
+}
+
+// PullRequests returns a snapshot of all cached pull requests.
+func (c *Cache) PullRequests() []PullRequest {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	pullRequests := make([]PullRequest, 0, len(c.pullRequests))
+	for _, pr := range c.pullRequests {
+		pullRequests = append(pullRequests, pr)
+	}
+	return pullRequests
+}
+
+// syncConnection pages through a connection in descending order of last update, saving each page along with the
+// resulting sync state, until it reaches a node which was last updated before the watermark.
+// It returns the number of nodes saved.
+func syncConnection[T any](ctx context.Context, state *syncState, fetch func(context.Context, *githubv4.String) (page[T], error), save func([]T, syncState) error) (int, error) {
+	if state.Cursor == nil {
+		state.PendingWatermark = state.Watermark
+	}
+
+	var saved int
+	for {
+		p, err := fetch(ctx, state.Cursor)
+		if err != nil {
+			// the sync resumes from the current cursor next time
+			return saved, err
+		}
+
+		var (
+			done  = !p.hasNextPage
+			nodes = make([]T, 0, len(p.nodes))
+		)
+		for _, node := range p.nodes {
+			updatedAt := p.updatedAt(node)
+			if updatedAt.Before(state.Watermark) {
+				// every node from here on was already up to date as of the last sync
+				done = true
+				break
+			}
+
+			if updatedAt.After(state.PendingWatermark) {
+				state.PendingWatermark = updatedAt
+			}
+
+			nodes = append(nodes, node)
+		}
+
+		if done {
+			state.Watermark = state.PendingWatermark
+			state.Cursor = nil
+		} else {
+			cursor := p.endCursor
+			state.Cursor = &cursor
+		}
+
+		if err := save(nodes, *state); err != nil {
+			return saved, err
+		}
+		saved += len(nodes)
+
+		if done {
+			return saved, nil
+		}
+	}
+}
+
+func (c *Cache) fetchIssues(ctx context.Context, cursor *githubv4.String) (page[Issue], error) {
+	var query struct {
+		Base
+
+		Repository struct {
+			Issues struct {
+				Nodes []struct {
+					Number            int
+					State             githubv4.IssueState
+					CreatedAt         githubv4.DateTime
+					UpdatedAt         githubv4.DateTime
+					ClosedAt          *githubv4.DateTime
+					Author            actor
+					AuthorAssociation githubv4.CommentAuthorAssociation
+					Labels            labels      `graphql:"labels(first:20)"`
+					Comments          comments    `graphql:"comments(last:5)"`
+					Assignees         assignees   `graphql:"assignees(first:10)"`
+					Assignments       assignments `graphql:"assignments: timelineItems(last:10, itemTypes:[ASSIGNED_EVENT])"`
+				}
+
+				PageInfo struct {
+					EndCursor   githubv4.String
+					HasNextPage bool
+				}
+			} `graphql:"issues(first:$limit, after:$cursor, orderBy:{field:UPDATED_AT, direction:DESC})"`
+		} `graphql:"repository(name:$repo, owner:$owner)"`
+	}
+
+	err := c.exec.Execute(ctx, &query, map[string]interface{}{
+		"owner":  githubv4.String(c.repo.Owner),
+		"repo":   githubv4.String(c.repo.Repo),
+		"cursor": cursor,
+		"limit":  githubv4.Int(100),
+	})
+	if err != nil {
+		return page[Issue]{}, err
+	}
+
+	p := page[Issue]{
+		updatedAt:   func(issue Issue) time.Time { return issue.UpdatedAt },
+		endCursor:   query.Repository.Issues.PageInfo.EndCursor,
+		hasNextPage: query.Repository.Issues.PageInfo.HasNextPage,
+	}
+	for _, node := range query.Repository.Issues.Nodes {
+		p.nodes = append(p.nodes, Issue{
+			Number:            node.Number,
+			State:             node.State,
+			CreatedAt:         node.CreatedAt.Time,
+			UpdatedAt:         node.UpdatedAt.Time,
+			ClosedAt:          timeOf(node.ClosedAt),
+			Author:            node.Author.actor(),
+			AuthorAssociation: node.AuthorAssociation,
+			Labels:            node.Labels.names(),
+			RecentComments:    node.Comments.comments(),
+			Assignees:         node.Assignees.assignments(node.Assignments, node.CreatedAt.Time),
+		})
+	}
+
+	return p, nil
+}
+
+func (c *Cache) fetchPullRequests(ctx context.Context, cursor *githubv4.String) (page[PullRequest], error) {
+	var query struct {
+		Base
+
+		Repository struct {
+			PullRequests struct {
+				Nodes []struct {
+					Number            int
+					State             githubv4.PullRequestState
+					CreatedAt         githubv4.DateTime
+					UpdatedAt         githubv4.DateTime
+					ClosedAt          *githubv4.DateTime
+					MergedAt          *githubv4.DateTime
+					BaseRefName       string
+					Author            actor
+					AuthorAssociation githubv4.CommentAuthorAssociation
+					Labels            labels      `graphql:"labels(first:20)"`
+					Comments          comments    `graphql:"comments(last:5)"`
+					Assignees         assignees   `graphql:"assignees(first:10)"`
+					Assignments       assignments `graphql:"assignments: timelineItems(last:10, itemTypes:[ASSIGNED_EVENT])"`
+					Reviews           reviews     `graphql:"reviews(last:10, states:[APPROVED, CHANGES_REQUESTED, COMMENTED, DISMISSED])"`
+					Additions         int
+					Deletions         int
+					ChangedFiles      int
+					Commits           struct {
+						TotalCount int
+					}
+				}
+
+				PageInfo struct {
+					EndCursor   githubv4.String
+					HasNextPage bool
+				}
+			} `graphql:"pullRequests(first:$limit, after:$cursor, orderBy:{field:UPDATED_AT, direction:DESC})"`
+		} `graphql:"repository(name:$repo, owner:$owner)"`
+	}
+
+	err := c.exec.Execute(ctx, &query, map[string]interface{}{
+		"owner":  githubv4.String(c.repo.Owner),
+		"repo":   githubv4.String(c.repo.Repo),
+		"cursor": cursor,
+		"limit":  githubv4.Int(100),
+	})
+	if err != nil {
+		return page[PullRequest]{}, err
+	}
+
+	p := page[PullRequest]{
+		updatedAt:   func(pr PullRequest) time.Time { return pr.UpdatedAt },
+		endCursor:   query.Repository.PullRequests.PageInfo.EndCursor,
+		hasNextPage: query.Repository.PullRequests.PageInfo.HasNextPage,
+	}
+	for _, node := range query.Repository.PullRequests.Nodes {
+		p.nodes = append(p.nodes, PullRequest{
+			Number:            node.Number,
+			State:             node.State,
+			CreatedAt:         node.CreatedAt.Time,
+			UpdatedAt:         node.UpdatedAt.Time,
+			ClosedAt:          timeOf(node.ClosedAt),
+			MergedAt:          timeOf(node.MergedAt),
+			BaseRefName:       node.BaseRefName,
+			Author:            node.Author.actor(),
+			AuthorAssociation: node.AuthorAssociation,
+			Labels:            node.Labels.names(),
+			RecentComments:    node.Comments.comments(),
+			Assignees:         node.Assignees.assignments(node.Assignments, node.CreatedAt.Time),
+			RecentReviews:     node.Reviews.reviews(),
+			Additions:         node.Additions,
+			Deletions:         node.Deletions,
+			ChangedFiles:      node.ChangedFiles,
+			Commits:           node.Commits.TotalCount,
+		})
+	}
+
+	return p, nil
+}
+
+// numbers is the GraphQL representation of a page of the numbers of issues or pull requests.
+type numbers struct {
+	Nodes []struct {
+		Number int
+	}
+
+	PageInfo struct {
+		EndCursor   githubv4.String
+		HasNextPage bool
+	}
+}
+
+// fetchNumbers pages through a connection of issues or pull requests, returning the set of their numbers.
+func fetchNumbers(ctx context.Context, fetch func(context.Context, *githubv4.String) (numbers, error)) (map[int]struct{}, error) {
+	var (
+		set    = make(map[int]struct{})
+		cursor *githubv4.String
+	)
+
+	for {
+		p, err := fetch(ctx, cursor)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, node := range p.Nodes {
+			set[node.Number] = struct{}{}
+		}
+
+		if !p.PageInfo.HasNextPage {
+			return set, nil
+		}
+
+		cursor = githubv4.NewString(p.PageInfo.EndCursor)
+	}
+}
+
+func (c *Cache) fetchOpenIssueNumbers(ctx context.Context, cursor *githubv4.String) (numbers, error) {
+	var query struct {
+		Base
+
+		Repository struct {
+			Issues numbers `graphql:"issues(first:$limit, after:$cursor, states:[OPEN])"`
+		} `graphql:"repository(name:$repo, owner:$owner)"`
+	}
+
+	err := c.exec.Execute(ctx, &query, map[string]interface{}{
+		"owner":  githubv4.String(c.repo.Owner),
+		"repo":   githubv4.String(c.repo.Repo),
+		"cursor": cursor,
+		"limit":  githubv4.Int(100),
+	})
+	return query.Repository.Issues, err
+}
+
+func (c *Cache) fetchOpenPullRequestNumbers(ctx context.Context, cursor *githubv4.String) (numbers, error) {
+	var query struct {
+		Base
+
+		Repository struct {
+			PullRequests numbers `graphql:"pullRequests(first:$limit, after:$cursor, states:[OPEN])"`
+		} `graphql:"repository(name:$repo, owner:$owner)"`
+	}
+
+	err := c.exec.Execute(ctx, &query, map[string]interface{}{
+		"owner":  githubv4.String(c.repo.Owner),
+		"repo":   githubv4.String(c.repo.Repo),
+		"cursor": cursor,
+		"limit":  githubv4.Int(100),
+	})
+	return query.Repository.PullRequests, err
+}
+
+// actor is the GraphQL representation of an Actor. It is null for deleted ("ghost") accounts.
+type actor struct {
+	Login    string
+	Typename string `graphql:"__typename"`
+}
+
+func (a actor) actor() Actor {
+	return Actor{
+		Login: a.Login,
+		IsBot: a.Typename == "Bot",
+	}
+}
+
+// labels is the GraphQL representation of the labels applied to an issue or pull request.
+type labels struct {
+	Nodes []struct {
+		Name string
+	}
+}
+
+func (l labels) names() []string {
+	names := make([]string, 0, len(l.Nodes))
+	for _, node := range l.Nodes {
+		names = append(names, node.Name)
+	}
+	return names
+}
+
+// comments is the GraphQL representation of the comments on an issue or pull request.
+type comments struct {
+	Nodes []struct {
+		Author    actor
+		CreatedAt githubv4.DateTime
+	}
+}
+
+func (c comments) comments() []Comment {
+	comments := make([]Comment, 0, len(c.Nodes))
+	for _, node := range c.Nodes {
+		comments = append(comments, Comment{
+			Author:    node.Author.actor(),
+			CreatedAt: node.CreatedAt.Time,
+		})
+	}
+	return comments
+}
+
+// reviews is the GraphQL representation of the reviews of a pull request.
+type reviews struct {
+	Nodes []struct {
+		Author            actor
+		AuthorAssociation githubv4.CommentAuthorAssociation
+		SubmittedAt       *githubv4.DateTime
+	}
+}
+
+func (r reviews) reviews() []Review {
+	reviews := make([]Review, 0, len(r.Nodes))
+	for _, node := range r.Nodes {
+		if node.SubmittedAt == nil {
+			continue
+		}
+
+		reviews = append(reviews, Review{
+			Author:            node.Author.actor(),
+			AuthorAssociation: node.AuthorAssociation,
+			SubmittedAt:       node.SubmittedAt.Time,
+		})
+	}
+	return reviews
+}
+
+// assignees is the GraphQL representation of the users assigned to an issue or pull request.
+type assignees struct {
+	Nodes []struct {
+		Login string
+	}
+}
+
+// assignments is the GraphQL representation of the latest assignments of an issue or pull request.
+type assignments struct {
+	Nodes []struct {
+		AssignedEvent struct {
+			CreatedAt githubv4.DateTime
+			Assignee  struct {
+				User struct {
+					Login string
+				} `graphql:"... on User"`
+			}
+		} `graphql:"... on AssignedEvent"`
+	}
+}
+
+// assignments returns the current assignees along with when each was last assigned. Users whose assignment is older
+// than the latest assignments are treated as having been assigned upon creation.
+func (a assignees) assignments(events assignments, createdAt time.Time) []Assignment {
+	assignedAt := make(map[string]time.Time)
+	for _, node := range events.Nodes {
+		event := node.AssignedEvent
+		assignedAt[event.Assignee.User.Login] = event.CreatedAt.Time
+	}
+
+	assignments := make([]Assignment, 0, len(a.Nodes))
+	for _, node := range a.Nodes {
+		at, ok := assignedAt[node.Login]
+		if !ok {
+			at = createdAt
+		}
+
+		assignments = append(assignments, Assignment{Login: node.Login, AssignedAt: at})
+	}
+	return assignments
+}
+
+// timeOf returns the time of a nullable DateTime, or the zero time if it is null.
+func timeOf(dt *githubv4.DateTime) time.Time {
+	if dt == nil {
+		return time.Time{}
+	}
+	return dt.Time
+}
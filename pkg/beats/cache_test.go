@@ -0,0 +1,252 @@
+package beats
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dannykopping/repo-rhythm/pkg/rhythm"
+	"github.com/dannykopping/repo-rhythm/pkg/store"
+	"github.com/go-kit/log"
+	"github.com/shurcooL/githubv4"
+)
+
+// fakeConnection serves pages of issues, each given as its last update time, in the order given.
+type fakeConnection struct {
+	pages [][]time.Time
+	// failAt is the index of a page whose fetch fails, or -1
+	failAt int
+
+	cursors []*githubv4.String
+}
+
+func (f *fakeConnection) fetch(_ context.Context, cursor *githubv4.String) (page[Issue], error) {
+	f.cursors = append(f.cursors, cursor)
+
+	i := 0
+	if cursor != nil {
+		i, _ = strconv.Atoi(string(*cursor))
+	}
+	if i == f.failAt {
+		f.failAt = -1
+		return page[Issue]{}, errors.New("something went wrong")
+	}
+
+	p := page[Issue]{
+		updatedAt:   func(issue Issue) time.Time { return issue.UpdatedAt },
+		endCursor:   githubv4.String(strconv.Itoa(i + 1)),
+		hasNextPage: i+1 < len(f.pages),
+	}
+	for _, updatedAt := range f.pages[i] {
+		p.nodes = append(p.nodes, Issue{Number: len(p.nodes) + 1, UpdatedAt: updatedAt})
+	}
+	return p, nil
+}
+
+// at returns the time the given number of minutes after testNow.
+func at(minutes int) time.Time {
+	return testNow.Add(time.Duration(minutes) * time.Minute)
+}
+
+func TestSyncConnectionWatermark(t *testing.T) {
+	var (
+		state syncState
+		saved []syncState
+	)
+	save := func(_ []Issue, s syncState) error {
+		saved = append(saved, s)
+		return nil
+	}
+
+	// the first sync fetches every page, and the watermark only advances once the last page is saved
+	conn := &fakeConnection{pages: [][]time.Time{{at(30), at(20)}, {at(10), at(0)}}, failAt: -1}
+	n, err := syncConnection(context.Background(), &state, conn.fetch, save)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n != 4 {
+		t.Errorf("expected 4 nodes to be saved, got %d", n)
+	}
+	if len(saved) != 2 {
+		t.Fatalf("expected 2 pages to be saved, got %d", len(saved))
+	}
+	if !saved[0].Watermark.IsZero() || saved[0].Cursor == nil || !saved[0].PendingWatermark.Equal(at(30)) {
+		t.Errorf("expected the first page to be saved with a cursor and pending watermark only, got %+v", saved[0])
+	}
+	if !state.Watermark.Equal(at(30)) || state.Cursor != nil {
+		t.Errorf("expected the watermark to advance to the latest update once complete, got %+v", state)
+	}
+
+	// the next sync stops at the first node which was last updated before the watermark, even across pages
+	saved = nil
+	conn = &fakeConnection{pages: [][]time.Time{{at(50), at(40)}, {at(35), at(20)}, {at(10)}}, failAt: -1}
+	n, err = syncConnection(context.Background(), &state, conn.fetch, save)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n != 3 {
+		t.Errorf("expected 3 nodes to be saved, got %d", n)
+	}
+	if len(conn.cursors) != 2 {
+		t.Errorf("expected 2 pages to be fetched, got %d", len(conn.cursors))
+	}
+	if !state.Watermark.Equal(at(50)) || state.Cursor != nil {
+		t.Errorf("expected the watermark to advance to the latest update, got %+v", state)
+	}
+}
+
+func TestSyncConnectionResume(t *testing.T) {
+	state := syncState{Watermark: at(0)}
+	var nodes int
+	save := func(issues []Issue, _ syncState) error {
+		nodes += len(issues)
+		return nil
+	}
+
+	conn := &fakeConnection{pages: [][]time.Time{{at(30), at(20)}, {at(10), at(5)}, {at(-5)}}, failAt: 1}
+	if _, err := syncConnection(context.Background(), &state, conn.fetch, save); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	// the watermark is unchanged until the sync completes, but its progress so far is kept
+	if !state.Watermark.Equal(at(0)) {
+		t.Errorf("expected the watermark to be unchanged, got %s", state.Watermark)
+	}
+	if state.Cursor == nil || *state.Cursor != "1" {
+		t.Fatalf("expected the cursor to point at the second page, got %v", state.Cursor)
+	}
+	if !state.PendingWatermark.Equal(at(30)) {
+		t.Errorf("expected the pending watermark to be the latest update so far, got %s", state.PendingWatermark)
+	}
+
+	// the next sync resumes from the cursor rather than starting over
+	conn.cursors = nil
+	if _, err := syncConnection(context.Background(), &state, conn.fetch, save); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(conn.cursors) == 0 || conn.cursors[0] == nil || *conn.cursors[0] != "1" {
+		t.Errorf("expected the sync to resume from the second page, got cursors %v", conn.cursors)
+	}
+	if nodes != 4 {
+		t.Errorf("expected 4 nodes to be saved across both syncs, got %d", nodes)
+	}
+	if !state.Watermark.Equal(at(30)) || state.Cursor != nil {
+		t.Errorf("expected the watermark to include the updates seen before the error, got %+v", state)
+	}
+}
+
+// graphQLServer serves GraphQL queries with the given handler, which returns the "data" of the response
+// to the given query.
+func graphQLServer(t *testing.T, handler func(query string, variables map[string]interface{}) interface{}) *Executor {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Query     string
+			Variables map[string]interface{}
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"data": handler(req.Query, req.Variables)})
+	}))
+	t.Cleanup(srv.Close)
+
+	client := githubv4.NewEnterpriseClient(srv.URL, &http.Client{Transport: NewTransport(nil)})
+	return NewExecutor(rhythm.Default(), client, log.NewNopLogger())
+}
+
+func TestCacheReconcile(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		queries []string
+	)
+
+	exec := graphQLServer(t, func(query string, variables map[string]interface{}) interface{} {
+		mu.Lock()
+		queries = append(queries, query)
+		mu.Unlock()
+
+		switch {
+		case strings.Contains(query, "issues(states:[OPEN])"):
+			return map[string]interface{}{"repository": map[string]interface{}{
+				"issues":       map[string]interface{}{"totalCount": 2},
+				"pullRequests": map[string]interface{}{"totalCount": 1},
+			}}
+		case strings.Contains(query, "issues(first:$limit, after:$cursor, states:[OPEN])"):
+			// the open issues are served a page at a time
+			number, hasNextPage := 1, true
+			if variables["cursor"] != nil {
+				number, hasNextPage = 2, false
+			}
+			return map[string]interface{}{"repository": map[string]interface{}{
+				"issues": map[string]interface{}{
+					"nodes":    []interface{}{map[string]interface{}{"number": number}},
+					"pageInfo": map[string]interface{}{"endCursor": "next", "hasNextPage": hasNextPage},
+				},
+			}}
+		}
+
+		t.Errorf("unexpected query: %s", query)
+		return nil
+	})
+
+	st, err := store.Open(filepath.Join(t.TempDir(), "store.db"))
+	if err != nil {
+		t.Fatalf("opening store: %v", err)
+	}
+	defer st.Close()
+
+	repo := rhythm.Repository{Owner: "grafana", Repo: "loki"}
+	c := NewCache(rhythm.Default(), repo, exec, st)
+
+	// issue 3 was deleted or transferred, so it is still open in the cache but not in the repository
+	for _, issue := range []Issue{
+		{Number: 1, State: githubv4.IssueStateOpen},
+		{Number: 2, State: githubv4.IssueStateOpen},
+		{Number: 3, State: githubv4.IssueStateOpen},
+		{Number: 4, State: githubv4.IssueStateClosed},
+	} {
+		c.issues[issue.Number] = issue
+		if err := st.Save(repo, store.Record{Bucket: issuesBucket, Key: strconv.Itoa(issue.Number), Value: issue}); err != nil {
+			t.Fatalf("saving issue: %v", err)
+		}
+	}
+	c.pullRequests[10] = PullRequest{Number: 10, State: githubv4.PullRequestStateOpen}
+
+	removedIssues, removedPullRequests, err := c.reconcile(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if removedIssues != 1 || removedPullRequests != 0 {
+		t.Errorf("expected 1 issue and 0 pull requests to be removed, got %d and %d", removedIssues, removedPullRequests)
+	}
+
+	if _, ok := c.issues[3]; ok {
+		t.Error("expected issue 3 to be removed from the cache")
+	}
+	for _, number := range []int{1, 2, 4} {
+		if _, ok := c.issues[number]; !ok {
+			t.Errorf("expected issue %d to be kept", number)
+		}
+	}
+	if err := st.Get(repo, issuesBucket, "3", &Issue{}); !errors.Is(err, store.NotFoundErr) {
+		t.Errorf("expected issue 3 to be removed from the store, got %v", err)
+	}
+
+	// the open pull requests match, so their numbers are not fetched
+	if len(queries) != 3 {
+		t.Errorf("expected 3 queries, got %d: %v", len(queries), queries)
+	}
+}
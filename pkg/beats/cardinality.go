@@ -0,0 +1,32 @@
+package beats
+
+import "sort"
+
+// otherLabel is the label value under which series beyond a cardinality limit are aggregated.
+const otherLabel = "other"
+
+// topN returns the n keys with the highest counts, breaking ties by key so that the selection is stable
+// between ticks. All keys are returned if n is zero.
+func topN(counts map[string]int, n int) map[string]struct{} {
+	keys := make([]string, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+
+	if n > 0 && len(keys) > n {
+		keys = keys[:n]
+	}
+
+	top := make(map[string]struct{}, len(keys))
+	for _, key := range keys {
+		top[key] = struct{}{}
+	}
+	return top
+}
@@ -0,0 +1,375 @@
+package beats
+
+import (
+	"context"
+	"time"
+
+	"github.com/dannykopping/repo-rhythm/pkg/metrics"
+	"github.com/dannykopping/repo-rhythm/pkg/rhythm"
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/shurcooL/githubv4"
+)
+
+const (
+	sourcePullRequest   = "pull_request"
+	sourceDefaultBranch = "default_branch"
+
+	checkSuccess = "success"
+	checkFailure = "failure"
+	checkPending = "pending"
+)
+
+// Checks measures the health of CI, as reported by the checks and commit statuses of the head commits of open pull
+// requests and of the latest commits to the default branch: the overall state of each commit's checks, the failure
+// rate of each check, and how long check runs take. Checks beyond the configured limit are aggregated as "other".
+type Checks struct {
+	cfg  *rhythm.Config
+	repo rhythm.Repository
+	exec *Executor
+
+	commits     *prometheus.GaugeVec
+	failureRate metrics.GaugeVec
+	duration    metrics.Distribution
+}
+
+// checkRollup is the GraphQL representation of the combined checks and commit statuses of a commit.
+// It is null for commits without any checks or statuses.
+type checkRollup struct {
+	State    githubv4.StatusState
+	Contexts struct {
+		Nodes []struct {
+			Typename string `graphql:"__typename"`
+
+			CheckRun struct {
+				Name        string
+				Status      githubv4.CheckStatusState
+				Conclusion  *githubv4.CheckConclusionState
+				StartedAt   *githubv4.DateTime
+				CompletedAt *githubv4.DateTime
+			} `graphql:"... on CheckRun"`
+			StatusContext struct {
+				Context string
+				State   githubv4.StatusState
+			} `graphql:"... on StatusContext"`
+		}
+	} `graphql:"contexts(first:50)"`
+}
+
+// checkResults accumulates the results of checks and commit statuses over a tick.
+type checkResults struct {
+	commits map[checkSeries]float64
+	// checks holds the number of results of each kind by check name
+	checks map[string]map[string]float64
+	// durations holds the durations of completed check runs in hours by check name
+	durations map[string][]float64
+}
+
+// checkSeries identifies a series of the check commits gauge.
+type checkSeries struct {
+	source string
+	state  string
+}
+
+func (o *Checks) Name() string {
+	return "checks"
+}
+
+func (o *Checks) TickInterval() time.Duration {
+	return 5 * time.Minute
+}
+
+func (o *Checks) Setup(cfg *rhythm.Config, target *Target) {
+	o.cfg = cfg
+	o.repo = target.Repository
+	o.exec = target.Exec
+
+	constLabels := map[string]string{
+		"owner": target.Owner,
+		"repo":  target.Repo,
+	}
+
+	o.commits = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name:        "check_commits",
+		Help:        "Current number of open pull request heads and recent default branch commits by the combined state of their checks",
+		ConstLabels: constLabels,
+	}, []string{"source", "state"})
+	o.failureRate = metrics.NewGaugeVec(prometheus.GaugeOpts{
+		Name:        "check_failure_rate",
+		Help:        "Fraction of completed checks which failed on open pull request heads and recent default branch commits by check name, with less frequent checks aggregated as \"other\"",
+		ConstLabels: constLabels,
+	}, []string{"name"})
+	o.duration = metrics.NewDistribution(
+		metrics.DistributionOpts{
+			Name:           "check_run_duration",
+			Help:           "Distribution of completed check run durations on open pull request heads and recent default branch commits",
+			ConstLabels:    constLabels,
+			VariableLabels: []string{"name"},
+			Cumulative:     cfg.CumulativeDistributions,
+		},
+		map[string]float64{
+			"1m":  time.Minute.Hours(),
+			"2m":  (2 * time.Minute).Hours(),
+			"5m":  (5 * time.Minute).Hours(),
+			"10m": (10 * time.Minute).Hours(),
+			"15m": (15 * time.Minute).Hours(),
+			"30m": (30 * time.Minute).Hours(),
+			"1h":  time.Hour.Hours(),
+			"2h":  (2 * time.Hour).Hours(),
+			"6h":  (6 * time.Hour).Hours(),
+		},
+	)
+}
+
+func (o *Checks) Tick(ctx context.Context, logger log.Logger) error {
+	results := checkResults{
+		commits:   make(map[checkSeries]float64),
+		checks:    make(map[string]map[string]float64),
+		durations: make(map[string][]float64),
+	}
+	for _, source := range []string{sourcePullRequest, sourceDefaultBranch} {
+		for _, state := range []string{checkSuccess, checkFailure, checkPending} {
+			results.commits[checkSeries{source, state}] = 0
+		}
+	}
+
+	if err := o.pullRequests(ctx, &results); err != nil {
+		return err
+	}
+	if err := o.defaultBranch(ctx, &results); err != nil {
+		return err
+	}
+
+	for series, count := range results.commits {
+		o.commits.WithLabelValues(series.source, series.state).Set(count)
+	}
+
+	labelled := o.labelled(results.checks)
+
+	// the results of checks beyond the limit are combined, so that "other" has their overall failure rate
+	checks := make(map[string]map[string]float64)
+	for name, counts := range results.checks {
+		if _, ok := labelled[name]; !ok {
+			name = otherLabel
+		}
+		if checks[name] == nil {
+			checks[name] = make(map[string]float64)
+		}
+		for result, count := range counts {
+			checks[name][result] += count
+		}
+	}
+
+	failureRate := o.failureRate.NewSnapshot()
+	for name, counts := range checks {
+		completed := counts[checkSuccess] + counts[checkFailure]
+		if completed == 0 {
+			continue
+		}
+		failureRate.Set(counts[checkFailure]/completed, name)
+	}
+
+	duration := o.duration.NewSnapshot()
+	for name, hours := range results.durations {
+		if _, ok := labelled[name]; !ok {
+			name = otherLabel
+		}
+		for _, h := range hours {
+			duration.Observe(h, name)
+		}
+	}
+
+	o.failureRate.Swap(failureRate)
+	o.duration.Swap(duration)
+	return nil
+}
+
+// labelled returns the names of the checks to label individually: those in the allowlist if there is one,
+// or otherwise those which ran most often.
+func (o *Checks) labelled(checks map[string]map[string]float64) map[string]struct{} {
+	if len(o.cfg.Checks.Allowlist) > 0 {
+		labelled := make(map[string]struct{}, len(o.cfg.Checks.Allowlist))
+		for _, name := range o.cfg.Checks.Allowlist {
+			labelled[name] = struct{}{}
+		}
+		return labelled
+	}
+
+	counts := make(map[string]int, len(checks))
+	for name, results := range checks {
+		for _, count := range results {
+			counts[name] += int(count)
+		}
+	}
+	return topN(counts, o.cfg.Checks.TopN)
+}
+
+// pullRequests records the checks of the head commit of each open pull request.
+func (o *Checks) pullRequests(ctx context.Context, results *checkResults) error {
+	variables := map[string]interface{}{
+		"owner":  githubv4.String(o.repo.Owner),
+		"repo":   githubv4.String(o.repo.Repo),
+		"cursor": (*githubv4.String)(nil),
+		"limit":  githubv4.Int(25),
+	}
+
+	for {
+		var query struct {
+			Base
+
+			Repository struct {
+				PullRequests struct {
+					Nodes []struct {
+						Commits struct {
+							Nodes []struct {
+								Commit struct {
+									StatusCheckRollup *checkRollup
+								}
+							}
+						} `graphql:"commits(last:1)"`
+					}
+
+					PageInfo struct {
+						EndCursor   githubv4.String
+						HasNextPage bool
+					}
+				} `graphql:"pullRequests(first:$limit, after:$cursor, states:[OPEN])"`
+			} `graphql:"repository(name:$repo, owner:$owner)"`
+		}
+
+		if err := o.exec.Execute(ctx, &query, variables); err != nil {
+			return err
+		}
+
+		prs := query.Repository.PullRequests
+		for _, pr := range prs.Nodes {
+			for _, node := range pr.Commits.Nodes {
+				results.record(sourcePullRequest, node.Commit.StatusCheckRollup)
+			}
+		}
+
+		if !prs.PageInfo.HasNextPage {
+			return nil
+		}
+
+		variables["cursor"] = githubv4.NewString(prs.PageInfo.EndCursor)
+	}
+}
+
+// defaultBranch records the checks of the latest commits to the default branch.
+func (o *Checks) defaultBranch(ctx context.Context, results *checkResults) error {
+	if o.cfg.Checks.Commits == 0 {
+		return nil
+	}
+
+	var query struct {
+		Base
+
+		Repository struct {
+			DefaultBranchRef *struct {
+				Target struct {
+					Commit struct {
+						History struct {
+							Nodes []struct {
+								StatusCheckRollup *checkRollup
+							}
+						} `graphql:"history(first:$limit)"`
+					} `graphql:"... on Commit"`
+				}
+			}
+		} `graphql:"repository(name:$repo, owner:$owner)"`
+	}
+
+	err := o.exec.Execute(ctx, &query, map[string]interface{}{
+		"owner": githubv4.String(o.repo.Owner),
+		"repo":  githubv4.String(o.repo.Repo),
+		"limit": githubv4.Int(o.cfg.Checks.Commits),
+	})
+	if err != nil {
+		return err
+	}
+
+	if query.Repository.DefaultBranchRef == nil {
+		// the repository is empty
+		return nil
+	}
+
+	for _, node := range query.Repository.DefaultBranchRef.Target.Commit.History.Nodes {
+		results.record(sourceDefaultBranch, node.StatusCheckRollup)
+	}
+	return nil
+}
+
+// record adds the checks and commit statuses of a commit to the results.
+func (r *checkResults) record(source string, rollup *checkRollup) {
+	if rollup == nil {
+		return
+	}
+
+	r.commits[checkSeries{source, statusResult(rollup.State)}]++
+
+	for _, node := range rollup.Contexts.Nodes {
+		var name, result string
+
+		switch node.Typename {
+		case "CheckRun":
+			run := node.CheckRun
+			name, result = run.Name, checkRunResult(run.Status, run.Conclusion)
+
+			if run.StartedAt != nil && run.CompletedAt != nil {
+				hours := run.CompletedAt.Sub(run.StartedAt.Time)
+				r.durations[name] = append(r.durations[name], hours.Hours())
+			}
+		case "StatusContext":
+			name, result = node.StatusContext.Context, statusResult(node.StatusContext.State)
+		default:
+			continue
+		}
+
+		if r.checks[name] == nil {
+			r.checks[name] = make(map[string]float64)
+		}
+		r.checks[name][result]++
+	}
+}
+
+// statusResult reduces a commit status state to success, failure or pending.
+func statusResult(state githubv4.StatusState) string {
+	switch state {
+	case githubv4.StatusStateSuccess:
+		return checkSuccess
+	case githubv4.StatusStateFailure, githubv4.StatusStateError:
+		return checkFailure
+	default:
+		return checkPending
+	}
+}
+
+// checkRunResult reduces the status and conclusion of a check run to success, failure or pending. Check runs which
+// completed without passing or failing, e.g. because they were skipped or cancelled, have no result.
+func checkRunResult(status githubv4.CheckStatusState, conclusion *githubv4.CheckConclusionState) string {
+	if status != githubv4.CheckStatusStateCompleted || conclusion == nil {
+		return checkPending
+	}
+
+	switch *conclusion {
+	case githubv4.CheckConclusionStateSuccess:
+		return checkSuccess
+	case githubv4.CheckConclusionStateFailure, githubv4.CheckConclusionStateTimedOut, githubv4.CheckConclusionStateStartupFailure:
+		return checkFailure
+	default:
+		return ""
+	}
+}
+
+func (o *Checks) Collect(ch chan<- prometheus.Metric) {
+	o.commits.Collect(ch)
+	o.failureRate.Collect(ch)
+	o.duration.Collect(ch)
+}
+
+func (o *Checks) Describe(ch chan<- *prometheus.Desc) {
+	o.commits.Describe(ch)
+	o.failureRate.Describe(ch)
+	o.duration.Describe(ch)
+}
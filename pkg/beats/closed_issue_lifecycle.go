@@ -1,7 +1,7 @@
 package beats
 
 import (
-	"fmt"
+	"context"
 	"time"
 
 	"github.com/dannykopping/repo-rhythm/pkg/metrics"
@@ -12,8 +12,10 @@ import (
 )
 
 type ClosedIssueLifecycle struct {
-	cfg  *rhythm.Config
-	exec *Executor
+	cfg   *rhythm.Config
+	repo  rhythm.Repository
+	exec  *Executor
+	cache *Cache
 
 	lifecycle metrics.Distribution
 }
@@ -22,87 +24,55 @@ func (o *ClosedIssueLifecycle) Name() string {
 	return "closed issues lifecycle"
 }
 
-func (o *ClosedIssueLifecycle) Setup(cfg *rhythm.Config, exec *Executor) {
+// TickInterval is longer than the default since closed issue lifecycles change slowly.
+func (o *ClosedIssueLifecycle) TickInterval() time.Duration {
+	return time.Hour
+}
+
+func (o *ClosedIssueLifecycle) Setup(cfg *rhythm.Config, target *Target) {
 	o.cfg = cfg
-	o.exec = exec
+	o.repo = target.Repository
+	o.exec = target.Exec
+	o.cache = target.Cache
 
 	o.lifecycle = metrics.NewDistribution(
 		metrics.DistributionOpts{
 			Name: "closed_issue_lifecycle",
-			Help: "Distribution of closed issue lifecycles (creation to closed time) by days",
+			Help: "Distribution of closed issue lifecycles (creation to closed time) by days, for issues closed within each window",
 			ConstLabels: map[string]string{
-				"owner": cfg.Owner,
-				"repo":  cfg.Repo,
+				"owner": target.Owner,
+				"repo":  target.Repo,
 			},
+			VariableLabels: []string{"window"},
+			Cumulative:     cfg.CumulativeDistributions,
 		},
 		CreateDayBuckets(),
 	)
 }
 
-func (o *ClosedIssueLifecycle) Tick(log.Logger) error {
-	type issue struct {
-		Id        githubv4.ID
-		CreatedAt githubv4.DateTime
-		ClosedAt  githubv4.DateTime
+func (o *ClosedIssueLifecycle) Tick(ctx context.Context, logger log.Logger) error {
+	if err := o.cache.Sync(ctx, logger); err != nil {
+		return err
 	}
 
-	var (
-		pageSize uint = 100
-		now           = time.Now()
-		fetched       = 0
-
-		variables = map[string]interface{}{
-			"owner":  githubv4.String(o.cfg.Owner),
-			"repo":   githubv4.String(o.cfg.Repo),
-			"state":  []githubv4.IssueState{githubv4.IssueStateClosed},
-			"cursor": (*githubv4.String)(nil),
-			"limit":  githubv4.Int(pageSize),
-		}
-
-		issues []issue
-	)
-
-	for {
-		var query struct {
-			Base
-
-			Repository struct {
-				Issues struct {
-					Nodes []issue
+	now := time.Now()
 
-					PageInfo struct {
-						EndCursor   githubv4.String
-						HasNextPage bool
-					}
-				} `graphql:"issues(states:$state, first:$limit, after:$cursor)"`
-			} `graphql:"repository(name:$repo, owner:$owner)"`
+	lifecycle := o.lifecycle.NewSnapshot()
+	for _, issue := range o.cache.Issues() {
+		// an issue which was closed and later reopened has a ClosedAt, but is not closed
+		if issue.State != githubv4.IssueStateClosed {
+			continue
 		}
 
-		err := o.exec.Execute(&query, variables)
-		if err != nil {
-			// don't export metric upon error; the error is handled by the executor
-			return err
+		hours := issue.ClosedAt.Sub(issue.CreatedAt)
+		for _, window := range o.cfg.ClosedIssueLifecycle.Windows {
+			if window.Contains(issue.ClosedAt, now) {
+				lifecycle.Observe(hours.Hours(), window.String())
+			}
 		}
-
-		issues = append(issues, query.Repository.Issues.Nodes...)
-
-		fetched += len(query.Repository.Issues.Nodes)
-		// TODO: logger
-		fmt.Println(fetched)
-
-		if !query.Repository.Issues.PageInfo.HasNextPage {
-			break
-		}
-
-		variables["cursor"] = githubv4.NewString(query.Repository.Issues.PageInfo.EndCursor)
-	}
-
-	o.lifecycle.Reset()
-	for _, issue := range issues {
-		hours := now.Sub(issue.CreatedAt.Time)
-		o.lifecycle.Observe(hours.Hours())
 	}
 
+	o.lifecycle.Swap(lifecycle)
 	return nil
 }
 
@@ -0,0 +1,266 @@
+package beats
+
+import (
+	"context"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/dannykopping/repo-rhythm/pkg/metrics"
+	"github.com/dannykopping/repo-rhythm/pkg/rhythm"
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/shurcooL/githubv4"
+)
+
+const (
+	viaPullRequest = "pull_request"
+	viaDirectPush  = "direct_push"
+)
+
+// Commits measures activity on the default branch: the number of commits and distinct commit authors within each of
+// the configured windows, and when commits are authored, by hour of day and day of week in the author's timezone.
+// Commits are split by whether they arrived via a merged pull request or were pushed directly to the branch.
+type Commits struct {
+	cfg  *rhythm.Config
+	repo rhythm.Repository
+	exec *Executor
+
+	commits *prometheus.GaugeVec
+	authors *prometheus.GaugeVec
+	hour    metrics.Distribution
+	weekday metrics.Distribution
+}
+
+// commit is a commit on the default branch.
+type commit struct {
+	// author is the login of the commit's author if it is associated with a GitHub user, or its email otherwise
+	author string
+	// authoredAt is in the author's timezone
+	authoredAt  time.Time
+	committedAt time.Time
+	via         string
+}
+
+func (o *Commits) Name() string {
+	return "commits"
+}
+
+func (o *Commits) TickInterval() time.Duration {
+	return 15 * time.Minute
+}
+
+func (o *Commits) Setup(cfg *rhythm.Config, target *Target) {
+	o.cfg = cfg
+	o.repo = target.Repository
+	o.exec = target.Exec
+
+	constLabels := map[string]string{
+		"owner": target.Owner,
+		"repo":  target.Repo,
+	}
+
+	o.commits = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name:        "default_branch_commits",
+		Help:        "Number of commits to the default branch within each window, by whether they arrived via a pull request",
+		ConstLabels: constLabels,
+	}, []string{"window", "via"})
+	o.authors = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name:        "default_branch_commit_authors",
+		Help:        "Number of distinct authors of commits to the default branch within each window",
+		ConstLabels: constLabels,
+	}, []string{"window"})
+
+	// the last hour and weekday are unbounded, so that no "+Inf" bucket is added which would only ever be empty
+	hours := make(map[string]float64, 24)
+	for h := 0; h < 23; h++ {
+		hours[time.Date(0, 1, 1, h, 0, 0, 0, time.UTC).Format("15")] = float64(h)
+	}
+	hours["23"] = math.Inf(1)
+	o.hour = metrics.NewDistribution(
+		metrics.DistributionOpts{
+			Name:           "default_branch_commit_hour",
+			Help:           "Distribution of commits to the default branch within the longest window by hour of day in the author's timezone",
+			ConstLabels:    constLabels,
+			VariableLabels: []string{"via"},
+			Cumulative:     cfg.CumulativeDistributions,
+		},
+		hours,
+	)
+
+	weekdays := make(map[string]float64, 7)
+	for d := time.Sunday; d < time.Saturday; d++ {
+		weekdays[strings.ToLower(d.String())] = float64(d)
+	}
+	weekdays[strings.ToLower(time.Saturday.String())] = math.Inf(1)
+	o.weekday = metrics.NewDistribution(
+		metrics.DistributionOpts{
+			Name:           "default_branch_commit_weekday",
+			Help:           "Distribution of commits to the default branch within the longest window by day of week in the author's timezone",
+			ConstLabels:    constLabels,
+			VariableLabels: []string{"via"},
+			Cumulative:     cfg.CumulativeDistributions,
+		},
+		weekdays,
+	)
+}
+
+func (o *Commits) Tick(ctx context.Context, logger log.Logger) error {
+	now := time.Now()
+
+	// fetch enough history to cover the longest window; nil fetches all of it
+	var since *githubv4.GitTimestamp
+	for _, window := range o.cfg.Commits.Windows {
+		if window == rhythm.AllTime {
+			since = nil
+			break
+		}
+		if start := window.Start(now); since == nil || start.Before(since.Time) {
+			since = &githubv4.GitTimestamp{Time: start}
+		}
+	}
+
+	commits, err := o.fetchCommits(ctx, since)
+	if err != nil {
+		return err
+	}
+
+	hour := o.hour.NewSnapshot()
+	weekday := o.weekday.NewSnapshot()
+	for _, c := range commits {
+		// commits are fetched as far back as the longest window, so all of them are observed
+		hour.Observe(float64(c.authoredAt.Hour()), c.via)
+		weekday.Observe(float64(c.authoredAt.Weekday()), c.via)
+	}
+
+	for _, window := range o.cfg.Commits.Windows {
+		var (
+			counts  = map[string]float64{viaPullRequest: 0, viaDirectPush: 0}
+			authors = make(map[string]struct{})
+		)
+
+		for _, c := range commits {
+			if !window.Contains(c.committedAt, now) {
+				continue
+			}
+
+			counts[c.via]++
+			authors[c.author] = struct{}{}
+		}
+
+		for via, count := range counts {
+			o.commits.WithLabelValues(window.String(), via).Set(count)
+		}
+		o.authors.WithLabelValues(window.String()).Set(float64(len(authors)))
+	}
+
+	o.hour.Swap(hour)
+	o.weekday.Swap(weekday)
+	return nil
+}
+
+// fetchCommits pages through the history of the default branch committed since the given time, if any. A commit is
+// considered to have arrived via a pull request if it is associated with a pull request merged into the default branch.
+func (o *Commits) fetchCommits(ctx context.Context, since *githubv4.GitTimestamp) ([]commit, error) {
+	var (
+		commits []commit
+
+		variables = map[string]interface{}{
+			"owner":  githubv4.String(o.repo.Owner),
+			"repo":   githubv4.String(o.repo.Repo),
+			"since":  since,
+			"cursor": (*githubv4.String)(nil),
+			"limit":  githubv4.Int(100),
+		}
+	)
+
+	for {
+		var query struct {
+			Base
+
+			Repository struct {
+				DefaultBranchRef *struct {
+					Name   string
+					Target struct {
+						Commit struct {
+							History struct {
+								Nodes []struct {
+									AuthoredDate  githubv4.GitTimestamp
+									CommittedDate githubv4.GitTimestamp
+									Author        struct {
+										Email string
+										User  *struct {
+											Login string
+										}
+									}
+									AssociatedPullRequests struct {
+										Nodes []struct {
+											BaseRefName string
+											MergedAt    *githubv4.DateTime
+										}
+									} `graphql:"associatedPullRequests(first:5)"`
+								}
+
+								PageInfo struct {
+									EndCursor   githubv4.String
+									HasNextPage bool
+								}
+							} `graphql:"history(first:$limit, after:$cursor, since:$since)"`
+						} `graphql:"... on Commit"`
+					}
+				}
+			} `graphql:"repository(name:$repo, owner:$owner)"`
+		}
+
+		if err := o.exec.Execute(ctx, &query, variables); err != nil {
+			return nil, err
+		}
+
+		branch := query.Repository.DefaultBranchRef
+		if branch == nil {
+			// the repository is empty
+			return nil, nil
+		}
+
+		history := branch.Target.Commit.History
+		for _, node := range history.Nodes {
+			c := commit{
+				author:      node.Author.Email,
+				authoredAt:  node.AuthoredDate.Time,
+				committedAt: node.CommittedDate.Time,
+				via:         viaDirectPush,
+			}
+			if node.Author.User != nil {
+				c.author = node.Author.User.Login
+			}
+			for _, pr := range node.AssociatedPullRequests.Nodes {
+				if pr.MergedAt != nil && pr.BaseRefName == branch.Name {
+					c.via = viaPullRequest
+					break
+				}
+			}
+
+			commits = append(commits, c)
+		}
+
+		if !history.PageInfo.HasNextPage {
+			return commits, nil
+		}
+
+		variables["cursor"] = githubv4.NewString(history.PageInfo.EndCursor)
+	}
+}
+
+func (o *Commits) Collect(ch chan<- prometheus.Metric) {
+	o.commits.Collect(ch)
+	o.authors.Collect(ch)
+	o.hour.Collect(ch)
+	o.weekday.Collect(ch)
+}
+
+func (o *Commits) Describe(ch chan<- *prometheus.Desc) {
+	o.commits.Describe(ch)
+	o.authors.Describe(ch)
+	o.hour.Describe(ch)
+	o.weekday.Describe(ch)
+}
@@ -0,0 +1,163 @@
+package beats
+
+import (
+	"context"
+	"time"
+
+	"github.com/dannykopping/repo-rhythm/pkg/rhythm"
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/shurcooL/githubv4"
+)
+
+const (
+	rolePullRequestAuthor = "pull_request_author"
+	roleIssueAuthor       = "issue_author"
+	roleReviewer          = "reviewer"
+
+	affiliationMember   = "member"
+	affiliationExternal = "external"
+)
+
+// Contributors counts the distinct people who opened issues and pull requests or reviewed pull requests within each
+// of the configured windows, split by whether they are members of the repository, along with how many of the authors
+// were contributing for the first time. Bots are not counted.
+//
+// Associations with the repository are as of each issue, pull request or review's last update, so a first-time
+// contributor whose pull request is merged is still counted as such until it is next updated.
+//
+// Reviewers are counted from the latest 10 reviews of each pull request, as cached, so those who only submitted
+// earlier reviews of pull requests with more reviews than that are not counted; the number of reviewers is a lower
+// bound.
+type Contributors struct {
+	cfg   *rhythm.Config
+	repo  rhythm.Repository
+	exec  *Executor
+	cache *Cache
+
+	contributors *prometheus.GaugeVec
+	firstTimers  *prometheus.GaugeVec
+}
+
+// contribution is an issue, pull request or review by a contributor.
+type contribution struct {
+	author      Actor
+	association githubv4.CommentAuthorAssociation
+	at          time.Time
+}
+
+func (o *Contributors) Name() string {
+	return "contributors"
+}
+
+func (o *Contributors) TickInterval() time.Duration {
+	return 10 * time.Minute
+}
+
+func (o *Contributors) Setup(cfg *rhythm.Config, target *Target) {
+	o.cfg = cfg
+	o.repo = target.Repository
+	o.exec = target.Exec
+	o.cache = target.Cache
+
+	o.contributors = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "contributors",
+		Help: "Number of distinct people who authored issues or pull requests, or submitted one of the latest 10 reviews of pull requests, within each window",
+		ConstLabels: map[string]string{
+			"owner": target.Owner,
+			"repo":  target.Repo,
+		},
+	}, []string{"role", "affiliation", "window"})
+	o.firstTimers = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "first_time_contributors",
+		Help: "Number of distinct first-time contributors who authored issues or pull requests within each window",
+		ConstLabels: map[string]string{
+			"owner": target.Owner,
+			"repo":  target.Repo,
+		},
+	}, []string{"role", "window"})
+}
+
+func (o *Contributors) Tick(ctx context.Context, logger log.Logger) error {
+	if err := o.cache.Sync(ctx, logger); err != nil {
+		return err
+	}
+
+	contributions := make(map[string][]contribution)
+	for _, issue := range o.cache.Issues() {
+		contributions[roleIssueAuthor] = append(contributions[roleIssueAuthor], contribution{issue.Author, issue.AuthorAssociation, issue.CreatedAt})
+	}
+	for _, pr := range o.cache.PullRequests() {
+		contributions[rolePullRequestAuthor] = append(contributions[rolePullRequestAuthor], contribution{pr.Author, pr.AuthorAssociation, pr.CreatedAt})
+
+		// only the latest reviews are cached, so earlier reviewers of busy pull requests are missed
+		for _, review := range pr.RecentReviews {
+			if review.Author.Login == pr.Author.Login {
+				continue
+			}
+			contributions[roleReviewer] = append(contributions[roleReviewer], contribution{review.Author, review.AuthorAssociation, review.SubmittedAt})
+		}
+	}
+
+	now := time.Now()
+
+	for _, window := range o.cfg.Contributors.Windows {
+		for _, role := range []string{rolePullRequestAuthor, roleIssueAuthor, roleReviewer} {
+			var (
+				// affiliations holds each contributor's affiliation as of their latest contribution
+				affiliations = make(map[string]contribution)
+				firstTimers  = make(map[string]struct{})
+			)
+
+			for _, c := range contributions[role] {
+				if c.author.Login == "" || o.cfg.IsBot(c.author.Login, c.author.IsBot) || !window.Contains(c.at, now) {
+					continue
+				}
+
+				if latest, ok := affiliations[c.author.Login]; !ok || c.at.After(latest.at) {
+					affiliations[c.author.Login] = c
+				}
+
+				switch c.association {
+				case githubv4.CommentAuthorAssociationFirstTimeContributor, githubv4.CommentAuthorAssociationFirstTimer:
+					firstTimers[c.author.Login] = struct{}{}
+				}
+			}
+
+			counts := map[string]float64{affiliationMember: 0, affiliationExternal: 0}
+			for _, c := range affiliations {
+				counts[affiliation(c.association)]++
+			}
+
+			for a, count := range counts {
+				o.contributors.WithLabelValues(role, a, window.String()).Set(count)
+			}
+			if role != roleReviewer {
+				o.firstTimers.WithLabelValues(role, window.String()).Set(float64(len(firstTimers)))
+			}
+		}
+	}
+
+	return nil
+}
+
+// affiliation returns whether a contributor with the given association is a member of the repository,
+// i.e. its owner, a member of the organization which owns it, or a collaborator.
+func affiliation(association githubv4.CommentAuthorAssociation) string {
+	switch association {
+	case githubv4.CommentAuthorAssociationOwner, githubv4.CommentAuthorAssociationMember, githubv4.CommentAuthorAssociationCollaborator:
+		return affiliationMember
+	default:
+		return affiliationExternal
+	}
+}
+
+func (o *Contributors) Collect(ch chan<- prometheus.Metric) {
+	o.contributors.Collect(ch)
+	o.firstTimers.Collect(ch)
+}
+
+func (o *Contributors) Describe(ch chan<- *prometheus.Desc) {
+	o.contributors.Describe(ch)
+	o.firstTimers.Describe(ch)
+}
@@ -1,8 +1,10 @@
 package beats
 
 import (
+	"context"
 	"time"
 
+	"github.com/dannykopping/repo-rhythm/pkg/metrics"
 	"github.com/dannykopping/repo-rhythm/pkg/rhythm"
 	"github.com/go-kit/log"
 	"github.com/prometheus/client_golang/prometheus"
@@ -10,11 +12,17 @@ import (
 )
 
 type Count struct {
-	cfg  *rhythm.Config
-	exec *Executor
+	cfg   *rhythm.Config
+	repo  rhythm.Repository
+	exec  *Executor
+	cache *Cache
 
 	issueCount       *prometheus.GaugeVec
 	pullRequestCount *prometheus.GaugeVec
+
+	// issueLabelCount and pullRequestLabelCount are only populated if label selectors are configured
+	issueLabelCount       metrics.GaugeVec
+	pullRequestLabelCount metrics.GaugeVec
 }
 
 func (o *Count) Name() string {
@@ -25,29 +33,47 @@ func (o *Count) TickInterval() time.Duration {
 	return time.Minute
 }
 
-func (o *Count) Setup(cfg *rhythm.Config, exec *Executor) {
+func (o *Count) Setup(cfg *rhythm.Config, target *Target) {
 	o.cfg = cfg
-	o.exec = exec
+	o.repo = target.Repository
+	o.exec = target.Exec
+	o.cache = target.Cache
 
 	o.issueCount = prometheus.NewGaugeVec(prometheus.GaugeOpts{
 		Name: "issues",
 		Help: "Current number of issues by state",
 		ConstLabels: map[string]string{
-			"owner": cfg.Owner,
-			"repo":  cfg.Repo,
+			"owner": target.Owner,
+			"repo":  target.Repo,
 		},
 	}, []string{"state"})
 	o.pullRequestCount = prometheus.NewGaugeVec(prometheus.GaugeOpts{
 		Name: "pull_requests",
 		Help: "Current number of pull requests by state",
 		ConstLabels: map[string]string{
-			"owner": cfg.Owner,
-			"repo":  cfg.Repo,
+			"owner": target.Owner,
+			"repo":  target.Repo,
 		},
 	}, []string{"state"})
+	o.issueLabelCount = metrics.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "issues_by_label",
+		Help: "Current number of issues by state and selected label",
+		ConstLabels: map[string]string{
+			"owner": target.Owner,
+			"repo":  target.Repo,
+		},
+	}, []string{"state", "label"})
+	o.pullRequestLabelCount = metrics.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "pull_requests_by_label",
+		Help: "Current number of pull requests by state and selected label",
+		ConstLabels: map[string]string{
+			"owner": target.Owner,
+			"repo":  target.Repo,
+		},
+	}, []string{"state", "label"})
 }
 
-func (o *Count) Tick(log.Logger) error {
+func (o *Count) Tick(ctx context.Context, logger log.Logger) error {
 	var query struct {
 		Base
 
@@ -67,9 +93,9 @@ func (o *Count) Tick(log.Logger) error {
 	for i := 0; i < len(issueStates); i++ {
 		issueState := issueStates[i]
 		prState := prStates[i]
-		err := o.exec.Execute(&query, map[string]interface{}{
-			"owner":      githubv4.String(o.cfg.Owner),
-			"repo":       githubv4.String(o.cfg.Repo),
+		err := o.exec.Execute(ctx, &query, map[string]interface{}{
+			"owner":      githubv4.String(o.repo.Owner),
+			"repo":       githubv4.String(o.repo.Repo),
 			"issueState": []githubv4.IssueState{issueState},
 			"prState":    []githubv4.PullRequestState{prState},
 		})
@@ -82,15 +108,49 @@ func (o *Count) Tick(log.Logger) error {
 		o.pullRequestCount.WithLabelValues(string(prState)).Set(query.Repository.PullRequests.TotalCount)
 	}
 
+	if len(o.cfg.Labels) == 0 {
+		return nil
+	}
+
+	return o.countByLabel(ctx, logger)
+}
+
+// countByLabel counts the cached issues and pull requests by state and selected label. Unlike the totals,
+// these can't be queried directly since labels are selected by pattern.
+func (o *Count) countByLabel(ctx context.Context, logger log.Logger) error {
+	if err := o.cache.Sync(ctx, logger); err != nil {
+		return err
+	}
+
+	issues := o.issueLabelCount.NewSnapshot()
+	for _, issue := range o.cache.Issues() {
+		for _, label := range selectLabels(issue.Labels, o.cfg.Labels) {
+			issues.Add(1, string(issue.State), label)
+		}
+	}
+
+	pullRequests := o.pullRequestLabelCount.NewSnapshot()
+	for _, pr := range o.cache.PullRequests() {
+		for _, label := range selectLabels(pr.Labels, o.cfg.Labels) {
+			pullRequests.Add(1, string(pr.State), label)
+		}
+	}
+
+	o.issueLabelCount.Swap(issues)
+	o.pullRequestLabelCount.Swap(pullRequests)
 	return nil
 }
 
 func (o *Count) Collect(ch chan<- prometheus.Metric) {
 	o.issueCount.Collect(ch)
 	o.pullRequestCount.Collect(ch)
+	o.issueLabelCount.Collect(ch)
+	o.pullRequestLabelCount.Collect(ch)
 }
 
 func (o *Count) Describe(ch chan<- *prometheus.Desc) {
 	o.issueCount.Describe(ch)
 	o.pullRequestCount.Describe(ch)
+	o.issueLabelCount.Describe(ch)
+	o.pullRequestLabelCount.Describe(ch)
 }
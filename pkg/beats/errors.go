@@ -0,0 +1,233 @@
+package beats
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+var RateLimitedErr = errors.New("rate-limited")
+var SecondaryRateLimitedErr = errors.New("secondary rate-limited")
+var TimeoutErr = errors.New("timeout")
+var TransientErr = errors.New("transient failure")
+
+// defaultSecondaryRetryAfter is used when a secondary rate limit response does not specify how long to wait,
+// as recommended by GitHub's documentation.
+const defaultSecondaryRetryAfter = time.Minute
+
+// QueryError is returned by Executor.Execute when a query fails.
+// Use errors.Is with RateLimitedErr, SecondaryRateLimitedErr, TimeoutErr or TransientErr to determine the kind
+// of failure; any other failure is permanent.
+type QueryError struct {
+	// Kind is one of the sentinel errors above, or nil if the failure is permanent.
+	Kind error
+	// RetryAfter is how long the API asked for clients to wait before retrying, if it did.
+	RetryAfter time.Duration
+	// Attempts is the number of times the query was attempted.
+	Attempts int
+
+	Err error
+}
+
+func (e *QueryError) Error() string {
+	kind := "permanent failure"
+	if e.Kind != nil {
+		kind = e.Kind.Error()
+	}
+
+	return fmt.Sprintf("query failed after %d attempt(s) (%s): %v", e.Attempts, kind, e.Err)
+}
+
+func (e *QueryError) Unwrap() error {
+	return e.Err
+}
+
+func (e *QueryError) Is(target error) bool {
+	return e.Kind != nil && target == e.Kind
+}
+
+// Retriable reports whether the query could succeed if attempted again.
+func (e *QueryError) Retriable() bool {
+	return e.Kind != nil
+}
+
+// HTTPError is returned for queries whose response had a non-200 status code.
+type HTTPError struct {
+	StatusCode int
+	Header     http.Header
+
+	// Err is the error returned by the GraphQL client, which includes the status and body of the response.
+	Err error
+}
+
+func (e *HTTPError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *HTTPError) Unwrap() error {
+	return e.Err
+}
+
+// httpResponse holds the status code and headers of the response to a query.
+type httpResponse struct {
+	statusCode int
+	header     http.Header
+}
+
+// responseKey is the context key under which the Executor passes an *httpResponse for the transport to fill in.
+type responseKey struct{}
+
+// transport records the status code and headers of each response in the *httpResponse carried by the request's
+// context, if any, so that the Executor can classify failed queries. Responses are passed on unchanged.
+type transport struct {
+	next http.RoundTripper
+}
+
+// NewTransport wraps the given http.RoundTripper so that errors returned to the Executor can be classified.
+func NewTransport(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+
+	return &transport{next: next}
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+
+	if r, ok := req.Context().Value(responseKey{}).(*httpResponse); ok {
+		r.statusCode, r.header = resp.StatusCode, resp.Header.Clone()
+	}
+
+	return resp, nil
+}
+
+// classify wraps the given error in a QueryError describing whether and when it can be retried.
+func classify(err error, now time.Time) *QueryError {
+	qe := &QueryError{Err: err}
+
+	var httpErr *HTTPError
+
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		qe.Kind = TimeoutErr
+	case errors.As(err, &httpErr):
+		qe.Kind, qe.RetryAfter = classifyHTTP(httpErr, now)
+	case isTemporaryNetErr(err):
+		qe.Kind = TransientErr
+	default:
+		// GraphQL errors are returned with a 200 status code, and can only be distinguished by their message
+		msg := strings.ToLower(err.Error())
+		switch {
+		case strings.Contains(msg, "secondary rate limit"), strings.Contains(msg, "abuse detection"):
+			qe.Kind, qe.RetryAfter = SecondaryRateLimitedErr, defaultSecondaryRetryAfter
+		case strings.Contains(msg, "rate limit"):
+			qe.Kind = RateLimitedErr
+		case strings.Contains(msg, "something went wrong"), strings.Contains(msg, "timedout"), strings.Contains(msg, "timeout"):
+			qe.Kind = TransientErr
+		}
+	}
+
+	return qe
+}
+
+func classifyHTTP(err *HTTPError, now time.Time) (error, time.Duration) {
+	retryAfter := parseRetryAfter(err.Header.Get("Retry-After"), now)
+	body := strings.ToLower(err.Err.Error())
+
+	switch {
+	case err.StatusCode == http.StatusTooManyRequests,
+		err.StatusCode == http.StatusForbidden && (strings.Contains(body, "secondary rate limit") || strings.Contains(body, "abuse")):
+		if retryAfter <= 0 {
+			retryAfter = defaultSecondaryRetryAfter
+		}
+		return SecondaryRateLimitedErr, retryAfter
+	case err.StatusCode == http.StatusForbidden && err.Header.Get("X-RateLimit-Remaining") == "0":
+		if retryAfter <= 0 {
+			if reset, ok := parseRateLimitReset(err.Header); ok {
+				retryAfter = reset.Sub(now)
+			}
+		}
+		return RateLimitedErr, retryAfter
+	case err.StatusCode >= 500:
+		return TransientErr, retryAfter
+	}
+
+	return nil, 0
+}
+
+// temporaryErrnos are the system call errors which are caused by the network or the API's availability, rather than
+// by e.g. the API's address not resolving or its certificate being invalid.
+var temporaryErrnos = []error{
+	syscall.ECONNRESET,
+	syscall.ECONNREFUSED,
+	syscall.ECONNABORTED,
+	syscall.EPIPE,
+	syscall.ETIMEDOUT,
+	syscall.EHOSTUNREACH,
+	syscall.ENETUNREACH,
+}
+
+// isTemporaryNetErr reports whether the given error is a network failure which may not recur if attempted again.
+func isTemporaryNetErr(err error) bool {
+	if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) {
+		// the connection was closed mid-response
+		return true
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return dnsErr.IsTimeout || dnsErr.IsTemporary
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	for _, errno := range temporaryErrnos {
+		if errors.Is(err, errno) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parseRateLimitReset parses the X-RateLimit-Reset header, which holds the time at which the rate limit resets
+// in seconds since the Unix epoch.
+func parseRateLimitReset(header http.Header) (time.Time, bool) {
+	reset, err := strconv.ParseInt(header.Get("X-RateLimit-Reset"), 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return time.Unix(reset, 0), true
+}
+
+// parseRetryAfter parses the value of a Retry-After header, which is either a number of seconds or an HTTP date.
+func parseRetryAfter(val string, now time.Time) time.Duration {
+	if val == "" {
+		return 0
+	}
+
+	if secs, err := strconv.Atoi(val); err == nil {
+		return time.Duration(secs) * time.Second
+	}
+
+	if t, err := http.ParseTime(val); err == nil {
+		return t.Sub(now)
+	}
+
+	return 0
+}
@@ -0,0 +1,250 @@
+package beats
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+)
+
+var testNow = time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func header(pairs ...string) http.Header {
+	h := make(http.Header)
+	for i := 0; i < len(pairs); i += 2 {
+		h.Set(pairs[i], pairs[i+1])
+	}
+	return h
+}
+
+// urlErr wraps the given error as the HTTP client would when a request fails.
+func urlErr(err error) error {
+	return &url.Error{Op: "Post", URL: "https://api.github.com/graphql", Err: err}
+}
+
+// timeoutErr is a net.Error for a timed out dial or read.
+type timeoutErr struct{}
+
+func (*timeoutErr) Error() string   { return "i/o timeout" }
+func (*timeoutErr) Timeout() bool   { return true }
+func (*timeoutErr) Temporary() bool { return true }
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		kind       error
+		retryAfter time.Duration
+	}{
+		{
+			name: "deadline exceeded",
+			err:  fmt.Errorf("querying: %w", context.DeadlineExceeded),
+			kind: TimeoutErr,
+		},
+		{
+			name: "http error",
+			err:  &HTTPError{StatusCode: http.StatusBadGateway, Header: header(), Err: errors.New("non-200 OK status code: 502 Bad Gateway")},
+			kind: TransientErr,
+		},
+		{
+			name: "unexpected EOF",
+			err:  urlErr(io.ErrUnexpectedEOF),
+			kind: TransientErr,
+		},
+		{
+			name: "connection reset",
+			err:  urlErr(&net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)}),
+			kind: TransientErr,
+		},
+		{
+			name: "dial timeout",
+			err:  urlErr(&net.OpError{Op: "dial", Net: "tcp", Err: &timeoutErr{}}),
+			kind: TransientErr,
+		},
+		{
+			name: "temporary DNS failure",
+			err:  urlErr(&net.OpError{Op: "dial", Net: "tcp", Err: &net.DNSError{Err: "server misbehaving", Name: "api.github.com", IsTemporary: true}}),
+			kind: TransientErr,
+		},
+		{
+			name: "DNS not found",
+			err:  urlErr(&net.OpError{Op: "dial", Net: "tcp", Err: &net.DNSError{Err: "no such host", Name: "api.github.com", IsNotFound: true}}),
+		},
+		{
+			name: "certificate error",
+			err:  urlErr(errors.New("tls: failed to verify certificate: x509: certificate signed by unknown authority")),
+		},
+		{
+			name:       "secondary rate limit message",
+			err:        errors.New("You have exceeded a secondary rate limit. Please wait a few minutes before you try again."),
+			kind:       SecondaryRateLimitedErr,
+			retryAfter: defaultSecondaryRetryAfter,
+		},
+		{
+			name: "rate limit message",
+			err:  errors.New("API rate limit exceeded for user ID 1."),
+			kind: RateLimitedErr,
+		},
+		{
+			name: "something went wrong message",
+			err:  errors.New("Something went wrong while executing your query. Please include `ABCD:1234` when reporting this issue."),
+			kind: TransientErr,
+		},
+		{
+			name: "other message",
+			err:  errors.New("Could not resolve to a Repository with the name 'grafana/nope'."),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			qe := classify(tt.err, testNow)
+
+			if qe.Kind != tt.kind {
+				t.Errorf("expected kind %v, got %v", tt.kind, qe.Kind)
+			}
+			if qe.RetryAfter != tt.retryAfter {
+				t.Errorf("expected retry after %s, got %s", tt.retryAfter, qe.RetryAfter)
+			}
+			if qe.Retriable() != (tt.kind != nil) {
+				t.Errorf("expected retriable to be %v", tt.kind != nil)
+			}
+			if !errors.Is(qe, tt.err) {
+				t.Errorf("expected query error to wrap %v", tt.err)
+			}
+		})
+	}
+}
+
+func TestClassifyHTTP(t *testing.T) {
+	reset := strconv.FormatInt(testNow.Add(10*time.Minute).Unix(), 10)
+
+	tests := []struct {
+		name       string
+		status     int
+		header     http.Header
+		body       string
+		kind       error
+		retryAfter time.Duration
+	}{
+		{
+			name:       "429 without Retry-After",
+			status:     http.StatusTooManyRequests,
+			header:     header(),
+			kind:       SecondaryRateLimitedErr,
+			retryAfter: defaultSecondaryRetryAfter,
+		},
+		{
+			name:       "429 with Retry-After",
+			status:     http.StatusTooManyRequests,
+			header:     header("Retry-After", "30"),
+			kind:       SecondaryRateLimitedErr,
+			retryAfter: 30 * time.Second,
+		},
+		{
+			name:       "403 secondary rate limit body",
+			status:     http.StatusForbidden,
+			header:     header(),
+			body:       "You have exceeded a secondary rate limit",
+			kind:       SecondaryRateLimitedErr,
+			retryAfter: defaultSecondaryRetryAfter,
+		},
+		{
+			name:       "403 secondary rate limit body with Retry-After",
+			status:     http.StatusForbidden,
+			header:     header("Retry-After", "120"),
+			body:       "You have exceeded a secondary rate limit",
+			kind:       SecondaryRateLimitedErr,
+			retryAfter: 2 * time.Minute,
+		},
+		{
+			name:       "403 rate limit exhausted",
+			status:     http.StatusForbidden,
+			header:     header("X-RateLimit-Remaining", "0", "X-RateLimit-Reset", reset),
+			body:       "API rate limit exceeded",
+			kind:       RateLimitedErr,
+			retryAfter: 10 * time.Minute,
+		},
+		{
+			name:       "403 rate limit exhausted with Retry-After",
+			status:     http.StatusForbidden,
+			header:     header("X-RateLimit-Remaining", "0", "X-RateLimit-Reset", reset, "Retry-After", "60"),
+			body:       "API rate limit exceeded",
+			kind:       RateLimitedErr,
+			retryAfter: time.Minute,
+		},
+		{
+			name:   "403 forbidden",
+			status: http.StatusForbidden,
+			header: header("X-RateLimit-Remaining", "4000"),
+			body:   "Resource not accessible by integration",
+		},
+		{
+			name:   "500",
+			status: http.StatusInternalServerError,
+			header: header(),
+			kind:   TransientErr,
+		},
+		{
+			name:       "503 with Retry-After",
+			status:     http.StatusServiceUnavailable,
+			header:     header("Retry-After", "5"),
+			kind:       TransientErr,
+			retryAfter: 5 * time.Second,
+		},
+		{
+			name:   "401",
+			status: http.StatusUnauthorized,
+			header: header(),
+			body:   "Bad credentials",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := &HTTPError{
+				StatusCode: tt.status,
+				Header:     tt.header,
+				Err:        fmt.Errorf("non-200 OK status code: %d body: %q", tt.status, tt.body),
+			}
+
+			kind, retryAfter := classifyHTTP(err, testNow)
+			if kind != tt.kind {
+				t.Errorf("expected kind %v, got %v", tt.kind, kind)
+			}
+			if retryAfter != tt.retryAfter {
+				t.Errorf("expected retry after %s, got %s", tt.retryAfter, retryAfter)
+			}
+		})
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		val  string
+		want time.Duration
+	}{
+		{val: "", want: 0},
+		{val: "0", want: 0},
+		{val: "90", want: 90 * time.Second},
+		{val: testNow.Add(2 * time.Minute).Format(http.TimeFormat), want: 2 * time.Minute},
+		{val: testNow.Add(-time.Minute).Format(http.TimeFormat), want: -time.Minute},
+		{val: "soon", want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.val, func(t *testing.T) {
+			if got := parseRetryAfter(tt.val, testNow); got != tt.want {
+				t.Errorf("expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
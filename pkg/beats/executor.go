@@ -4,6 +4,9 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"math/rand"
+	"net/http"
+	"time"
 
 	"github.com/dannykopping/repo-rhythm/pkg/rhythm"
 	"github.com/go-kit/log"
@@ -11,14 +14,12 @@ import (
 	"github.com/shurcooL/githubv4"
 )
 
-// TODO: errata
-var RateLimitedErr = errors.New("rate-limited")
-var TimeoutErr = errors.New("timeout")
-
 type Executor struct {
 	cfg    *rhythm.Config
 	client *githubv4.Client
 	logger log.Logger
+
+	budget *budget
 }
 
 func NewExecutor(cfg *rhythm.Config, client *githubv4.Client, logger log.Logger) *Executor {
@@ -26,32 +27,147 @@ func NewExecutor(cfg *rhythm.Config, client *githubv4.Client, logger log.Logger)
 		cfg:    cfg,
 		client: client,
 		logger: logger,
+		budget: newBudget(cfg.RateLimit.Reserve),
 	}
 }
 
 type WithRateLimiter interface {
-	RateLimitRemaining() int
+	RateLimitState() RateLimit
 }
 
-func (e *Executor) Execute(query WithRateLimiter, variables map[string]interface{}) error {
-	ctx, cancel := context.WithTimeout(context.Background(), e.cfg.TimeoutDuration)
+// Execute runs the given query once the rate limit allows it.
+// If the rate limit is exhausted, Execute waits until it resets; RateLimitedErr is returned
+// if that would take longer than the configured maximum wait.
+//
+// Queries which fail in a way that may succeed if attempted again are retried with a jittered exponential backoff,
+// or after as long as the API asks for. Any error returned is a *QueryError.
+func (e *Executor) Execute(ctx context.Context, query WithRateLimiter, variables map[string]interface{}) error {
+	for attempt := 1; ; attempt++ {
+		if err := e.wait(ctx); err != nil {
+			if ctx.Err() != nil {
+				return &QueryError{Attempts: attempt - 1, Err: err}
+			}
+			return &QueryError{Kind: RateLimitedErr, Attempts: attempt - 1, Err: err}
+		}
+
+		err := e.query(ctx, query, variables)
+		if err == nil {
+			break
+		}
+
+		if ctx.Err() != nil {
+			// the caller has given up, so there is no point in retrying
+			return &QueryError{Attempts: attempt, Err: ctx.Err()}
+		}
+
+		now := time.Now()
+		qe := classify(err, now)
+		qe.Attempts = attempt
+
+		if qe.Kind == RateLimitedErr && qe.RetryAfter <= 0 {
+			// GraphQL rate limit errors don't say when the limit resets, but the headers of the response do
+			qe.RetryAfter = e.budget.retryAfter(now)
+		}
+
+		if qe.RetryAfter > 0 && (qe.Kind == RateLimitedErr || qe.Kind == SecondaryRateLimitedErr) {
+			// rate limits apply to the token, so all queries are held back rather than just this one
+			e.budget.pause(now.Add(qe.RetryAfter))
+		}
+
+		if !qe.Retriable() || attempt >= e.cfg.Retry.MaxAttempts {
+			return qe
+		}
+
+		// retries wait no longer than the maximum backoff, unless they are waiting for a rate limit to reset
+		limit := e.cfg.Retry.MaxBackoff
+		if errors.Is(qe, RateLimitedErr) || errors.Is(qe, SecondaryRateLimitedErr) {
+			limit = e.cfg.RateLimit.MaxWait
+		}
+
+		delay := e.backoff(attempt, qe.RetryAfter)
+		if delay > limit {
+			return qe
+		}
+
+		level.Warn(e.logger).Log("msg", "query failed; retrying", "attempt", attempt, "delay", delay, "err", err)
+		if err := sleep(ctx, delay); err != nil {
+			return &QueryError{Attempts: attempt, Err: err}
+		}
+	}
+
+	rl := query.RateLimitState()
+	e.budget.update(rl)
+
+	level.Debug(e.logger).Log("msg", "query succeeded", "cost", rl.Cost, "rate_limit_remaining", rl.Remaining, "rate_limit_reset", rl.ResetAt.Time)
+
+	return nil
+}
+
+func (e *Executor) query(ctx context.Context, query WithRateLimiter, variables map[string]interface{}) error {
+	ctx, cancel := context.WithTimeout(ctx, e.cfg.TimeoutDuration)
 	defer cancel()
 
-	err := e.client.Query(ctx, query, variables)
+	// the GraphQL client reduces non-200 responses to an opaque error, so their status code and headers are
+	// recorded by the transport in order to classify them
+	var resp httpResponse
+	err := e.client.Query(context.WithValue(ctx, responseKey{}, &resp), query, variables)
+	if reset, ok := parseRateLimitReset(resp.header); ok {
+		e.budget.recordReset(reset)
+	}
+	if err != nil && resp.statusCode != 0 && resp.statusCode != http.StatusOK {
+		return &HTTPError{StatusCode: resp.statusCode, Header: resp.header, Err: err}
+	}
+
+	return err
+}
 
-	if errors.Is(err, context.DeadlineExceeded) {
-		return TimeoutErr
+// backoff returns the delay before the next attempt of a failed query.
+// The delay doubles with each attempt, and is jittered so that concurrent retries are spread out.
+func (e *Executor) backoff(attempt int, retryAfter time.Duration) time.Duration {
+	if retryAfter > 0 {
+		// the API knows best, but a little jitter still helps to avoid a thundering herd
+		return retryAfter + time.Duration(rand.Int63n(int64(time.Second)))
 	}
 
-	if err != nil {
-		return fmt.Errorf("failed to execute query: %w", err)
+	delay := e.cfg.Retry.MaxBackoff
+	if shift := attempt - 1; shift < 32 {
+		if d := e.cfg.Retry.MinBackoff << shift; d > 0 && d < delay {
+			delay = d
+		}
 	}
 
-	level.Debug(e.logger).Log("msg", "query succeeded", "rate_limit_remaining", query.RateLimitRemaining())
+	// "equal jitter": wait at least half of the delay
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+func (e *Executor) wait(ctx context.Context) error {
+	for {
+		delay := e.budget.acquire(time.Now())
+		if delay <= 0 {
+			return nil
+		}
 
-	if query.RateLimitRemaining() < 1 {
-		return RateLimitedErr
+		remaining, resetAt := e.budget.status()
+		if delay > e.cfg.RateLimit.MaxWait {
+			return fmt.Errorf("rate limit budget exhausted for %s, exceeding the maximum wait of %s", delay, e.cfg.RateLimit.MaxWait)
+		}
+
+		level.Info(e.logger).Log("msg", "rate limit budget exhausted; waiting for reset", "rate_limit_remaining", remaining, "rate_limit_reset", resetAt, "delay", delay)
+		if err := sleep(ctx, delay); err != nil {
+			return err
+		}
 	}
+}
 
-	return nil
+// sleep waits for the given duration, returning early with an error if the context is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
 }
@@ -0,0 +1,307 @@
+package beats
+
+import (
+	"context"
+	"time"
+
+	"github.com/dannykopping/repo-rhythm/pkg/metrics"
+	"github.com/dannykopping/repo-rhythm/pkg/rhythm"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/shurcooL/githubv4"
+)
+
+const (
+	kindIssue       = "issue"
+	kindPullRequest = "pull_request"
+)
+
+// responsesBucket is the store bucket under which the first responses of issues and pull requests are persisted.
+const responsesBucket = "first_responses"
+
+// FirstResponse measures how long issues and pull requests wait for their first response: a comment or review
+// by anyone other than their author, excluding bots. Issues and pull requests created by bots are not considered.
+// The time to first response is only measured for issues and pull requests created within the configured window,
+// whereas every open issue and pull request is counted while it awaits a response.
+type FirstResponse struct {
+	cfg   *rhythm.Config
+	repo  rhythm.Repository
+	exec  *Executor
+	cache *Cache
+
+	// responses remembers what is known about each issue and pull request, by number, so that their timelines
+	// are only fetched again once they are updated. It is persisted alongside the cache, and loaded on the first tick
+	// so that every timeline isn't fetched again after a restart.
+	responses map[int]response
+	loaded    bool
+
+	timeToFirstResponse metrics.Distribution
+	awaitingResponse    *prometheus.GaugeVec
+}
+
+type response struct {
+	UpdatedAt time.Time
+	// RespondedAt is zero if there has been no response as of UpdatedAt
+	RespondedAt time.Time
+}
+
+// responder is the GraphQL representation of a comment or review.
+type responder struct {
+	Author    actor
+	CreatedAt githubv4.DateTime
+}
+
+func (o *FirstResponse) Name() string {
+	return "first response"
+}
+
+func (o *FirstResponse) TickInterval() time.Duration {
+	return 10 * time.Minute
+}
+
+func (o *FirstResponse) Setup(cfg *rhythm.Config, target *Target) {
+	o.cfg = cfg
+	o.repo = target.Repository
+	o.exec = target.Exec
+	o.cache = target.Cache
+
+	o.timeToFirstResponse = metrics.NewDistribution(
+		metrics.DistributionOpts{
+			Name: "time_to_first_response",
+			Help: "Distribution of time from creation to first response for issues and pull requests by days",
+			ConstLabels: map[string]string{
+				"owner": target.Owner,
+				"repo":  target.Repo,
+			},
+			VariableLabels: []string{"kind"},
+			Cumulative:     cfg.CumulativeDistributions,
+		},
+		CreateDayBuckets(),
+	)
+	o.awaitingResponse = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "awaiting_first_response",
+		Help: "Current number of open issues and pull requests which have not had a response",
+		ConstLabels: map[string]string{
+			"owner": target.Owner,
+			"repo":  target.Repo,
+		},
+	}, []string{"kind"})
+}
+
+func (o *FirstResponse) Tick(ctx context.Context, logger log.Logger) error {
+	if err := o.cache.Sync(ctx, logger); err != nil {
+		return err
+	}
+
+	if !o.loaded {
+		responses, err := loadDerived[response](o.cache, responsesBucket)
+		if err != nil {
+			return err
+		}
+		o.responses, o.loaded = responses, true
+	}
+
+	var (
+		now    = time.Now()
+		window = o.cfg.FirstResponse.Window
+
+		timeToFirstResponse = o.timeToFirstResponse.NewSnapshot()
+		awaiting            = map[string]float64{kindIssue: 0, kindPullRequest: 0}
+		visited             = make(map[int]struct{})
+		fetched             int
+	)
+
+	observe := func(kind string, number int, author Actor, createdAt, updatedAt time.Time, open bool, recent []Actor) error {
+		if o.cfg.IsBot(author.Login, author.IsBot) {
+			return nil
+		}
+
+		inWindow := window.Contains(createdAt, now)
+		if !inWindow {
+			if !open {
+				return nil
+			}
+
+			// older open issues and pull requests are only counted while they await a response, so their timelines
+			// needn't be fetched if a recent comment or review already responded
+			for _, who := range recent {
+				if o.isResponse(who, author.Login) {
+					return nil
+				}
+			}
+		}
+
+		visited[number] = struct{}{}
+
+		resp, ok := o.responses[number]
+		if !ok || (resp.RespondedAt.IsZero() && updatedAt.After(resp.UpdatedAt)) {
+			respondedAt, err := o.firstResponse(ctx, kind, number, author.Login)
+			if err != nil {
+				return err
+			}
+
+			resp = response{UpdatedAt: updatedAt, RespondedAt: respondedAt}
+			o.responses[number] = resp
+			fetched++
+
+			if err := o.cache.saveDerived(responsesBucket, number, resp); err != nil {
+				return err
+			}
+		}
+
+		switch {
+		case resp.RespondedAt.IsZero():
+			if open {
+				awaiting[kind]++
+			}
+		case inWindow:
+			hours := resp.RespondedAt.Sub(createdAt)
+			timeToFirstResponse.Observe(hours.Hours(), kind)
+		}
+
+		return nil
+	}
+
+	for _, issue := range o.cache.Issues() {
+		err := observe(kindIssue, issue.Number, issue.Author, issue.CreatedAt, issue.UpdatedAt, issue.State == githubv4.IssueStateOpen,
+			commenters(issue.RecentComments))
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, pr := range o.cache.PullRequests() {
+		recent := commenters(pr.RecentComments)
+		for _, review := range pr.RecentReviews {
+			recent = append(recent, review.Author)
+		}
+
+		err := observe(kindPullRequest, pr.Number, pr.Author, pr.CreatedAt, pr.UpdatedAt, pr.State == githubv4.PullRequestStateOpen, recent)
+		if err != nil {
+			return err
+		}
+	}
+
+	level.Debug(logger).Log("msg", "fetched timelines", "fetched", fetched)
+
+	// forget about issues and pull requests which have since fallen out of the window and been closed or responded to
+	var forgotten []int
+	for number := range o.responses {
+		if _, ok := visited[number]; !ok {
+			delete(o.responses, number)
+			forgotten = append(forgotten, number)
+		}
+	}
+	if err := o.cache.deleteDerived(responsesBucket, forgotten); err != nil {
+		return err
+	}
+
+	o.timeToFirstResponse.Swap(timeToFirstResponse)
+	for kind, count := range awaiting {
+		o.awaitingResponse.WithLabelValues(kind).Set(count)
+	}
+
+	return nil
+}
+
+// firstResponse pages through the timeline of an issue or pull request until it finds the first comment or review
+// by anyone other than the author, excluding bots. It returns the zero time if there is no such response.
+func (o *FirstResponse) firstResponse(ctx context.Context, kind string, number int, author string) (time.Time, error) {
+	type timeline struct {
+		Nodes []struct {
+			IssueComment      responder `graphql:"... on IssueComment"`
+			PullRequestReview responder `graphql:"... on PullRequestReview"`
+		}
+
+		PageInfo struct {
+			EndCursor   githubv4.String
+			HasNextPage bool
+		}
+	}
+
+	variables := map[string]interface{}{
+		"owner":  githubv4.String(o.repo.Owner),
+		"repo":   githubv4.String(o.repo.Repo),
+		"number": githubv4.Int(number),
+		"cursor": (*githubv4.String)(nil),
+		"limit":  githubv4.Int(50),
+	}
+
+	for {
+		var items timeline
+
+		if kind == kindIssue {
+			var query struct {
+				Base
+
+				Repository struct {
+					Issue struct {
+						TimelineItems timeline `graphql:"timelineItems(first:$limit, after:$cursor, itemTypes:[ISSUE_COMMENT])"`
+					} `graphql:"issue(number:$number)"`
+				} `graphql:"repository(name:$repo, owner:$owner)"`
+			}
+
+			if err := o.exec.Execute(ctx, &query, variables); err != nil {
+				return time.Time{}, err
+			}
+			items = query.Repository.Issue.TimelineItems
+		} else {
+			var query struct {
+				Base
+
+				Repository struct {
+					PullRequest struct {
+						TimelineItems timeline `graphql:"timelineItems(first:$limit, after:$cursor, itemTypes:[ISSUE_COMMENT, PULL_REQUEST_REVIEW])"`
+					} `graphql:"pullRequest(number:$number)"`
+				} `graphql:"repository(name:$repo, owner:$owner)"`
+			}
+
+			if err := o.exec.Execute(ctx, &query, variables); err != nil {
+				return time.Time{}, err
+			}
+			items = query.Repository.PullRequest.TimelineItems
+		}
+
+		for _, node := range items.Nodes {
+			// the GraphQL client decodes each node into every fragment, so either holds the comment or review
+			r := node.IssueComment
+
+			if !o.isResponse(r.Author.actor(), author) {
+				continue
+			}
+
+			return r.CreatedAt.Time, nil
+		}
+
+		if !items.PageInfo.HasNextPage {
+			return time.Time{}, nil
+		}
+
+		variables["cursor"] = githubv4.NewString(items.PageInfo.EndCursor)
+	}
+}
+
+// isResponse reports whether a comment or review by the given actor responds to an issue or pull request by author.
+func (o *FirstResponse) isResponse(who Actor, author string) bool {
+	return who.Login != "" && who.Login != author && !o.cfg.IsBot(who.Login, who.IsBot)
+}
+
+// commenters returns the authors of the given comments.
+func commenters(comments []Comment) []Actor {
+	actors := make([]Actor, 0, len(comments))
+	for _, c := range comments {
+		actors = append(actors, c.Author)
+	}
+	return actors
+}
+
+func (o *FirstResponse) Collect(ch chan<- prometheus.Metric) {
+	o.timeToFirstResponse.Collect(ch)
+	o.awaitingResponse.Collect(ch)
+}
+
+func (o *FirstResponse) Describe(ch chan<- *prometheus.Desc) {
+	o.timeToFirstResponse.Describe(ch)
+	o.awaitingResponse.Describe(ch)
+}
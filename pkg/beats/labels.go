@@ -0,0 +1,25 @@
+package beats
+
+import "github.com/dannykopping/repo-rhythm/pkg/rhythm"
+
+// unlabelled is the label value of the series counting issues and pull requests with none of the selected labels.
+const unlabelled = "unlabelled"
+
+// selectLabels returns those of the given labels which match any of the selectors, or just "unlabelled"
+// if none match. An issue or pull request with several selected labels is counted once under each.
+func selectLabels(labels []string, selectors []rhythm.Pattern) []string {
+	var selected []string
+	for _, label := range labels {
+		for _, selector := range selectors {
+			if selector.Match(label) {
+				selected = append(selected, label)
+				break
+			}
+		}
+	}
+
+	if len(selected) == 0 {
+		return []string{unlabelled}
+	}
+	return selected
+}
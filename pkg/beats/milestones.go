@@ -0,0 +1,263 @@
+package beats
+
+import (
+	"context"
+	"time"
+
+	"github.com/dannykopping/repo-rhythm/pkg/metrics"
+	"github.com/dannykopping/repo-rhythm/pkg/rhythm"
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/shurcooL/githubv4"
+)
+
+// noStatus is the status label value of project items whose status field is not set.
+const noStatus = "none"
+
+// Milestones tracks the progress of open milestones: their open and closed issues and pull requests, how complete
+// they are, and when they are due. Optionally, it also counts the items of projects by their status.
+type Milestones struct {
+	cfg  *rhythm.Config
+	repo rhythm.Repository
+	exec *Executor
+
+	items        metrics.GaugeVec
+	progress     metrics.GaugeVec
+	dueTimestamp metrics.GaugeVec
+	daysUntilDue metrics.GaugeVec
+	projectItems metrics.GaugeVec
+}
+
+func (o *Milestones) Name() string {
+	return "milestones"
+}
+
+func (o *Milestones) TickInterval() time.Duration {
+	return 15 * time.Minute
+}
+
+func (o *Milestones) Setup(cfg *rhythm.Config, target *Target) {
+	o.cfg = cfg
+	o.repo = target.Repository
+	o.exec = target.Exec
+
+	constLabels := map[string]string{
+		"owner": target.Owner,
+		"repo":  target.Repo,
+	}
+
+	o.items = metrics.NewGaugeVec(prometheus.GaugeOpts{
+		Name:        "milestone_items",
+		Help:        "Current number of issues and pull requests in each open milestone by state",
+		ConstLabels: constLabels,
+	}, []string{"milestone", "kind", "state"})
+	o.progress = metrics.NewGaugeVec(prometheus.GaugeOpts{
+		Name:        "milestone_progress_percent",
+		Help:        "Percentage of the issues and pull requests in each open milestone which are closed",
+		ConstLabels: constLabels,
+	}, []string{"milestone"})
+	o.dueTimestamp = metrics.NewGaugeVec(prometheus.GaugeOpts{
+		Name:        "milestone_due_timestamp_seconds",
+		Help:        "Due date of each open milestone which has one",
+		ConstLabels: constLabels,
+	}, []string{"milestone"})
+	o.daysUntilDue = metrics.NewGaugeVec(prometheus.GaugeOpts{
+		Name:        "milestone_days_until_due",
+		Help:        "Days until each open milestone which has a due date is due; negative once past due",
+		ConstLabels: constLabels,
+	}, []string{"milestone"})
+	o.projectItems = metrics.NewGaugeVec(prometheus.GaugeOpts{
+		Name:        "project_items",
+		Help:        "Current number of unarchived items in each configured project by status",
+		ConstLabels: constLabels,
+	}, []string{"project", "status"})
+}
+
+func (o *Milestones) Tick(ctx context.Context, logger log.Logger) error {
+	if err := o.milestones(ctx); err != nil {
+		return err
+	}
+
+	projectItems := o.projectItems.NewSnapshot()
+	for _, number := range o.cfg.Milestones.Projects {
+		if err := o.project(ctx, number, projectItems); err != nil {
+			return err
+		}
+	}
+
+	o.projectItems.Swap(projectItems)
+	return nil
+}
+
+// milestones updates the metrics of each open milestone. Milestones which have since been closed are removed.
+func (o *Milestones) milestones(ctx context.Context) error {
+	type milestone struct {
+		Title              string
+		DueOn              *githubv4.DateTime
+		ProgressPercentage float64
+
+		OpenIssues struct {
+			TotalCount float64
+		} `graphql:"openIssues: issues(states:[OPEN])"`
+		ClosedIssues struct {
+			TotalCount float64
+		} `graphql:"closedIssues: issues(states:[CLOSED])"`
+		OpenPullRequests struct {
+			TotalCount float64
+		} `graphql:"openPullRequests: pullRequests(states:[OPEN])"`
+		ClosedPullRequests struct {
+			TotalCount float64
+		} `graphql:"closedPullRequests: pullRequests(states:[CLOSED, MERGED])"`
+	}
+
+	var (
+		milestones []milestone
+
+		variables = map[string]interface{}{
+			"owner":  githubv4.String(o.repo.Owner),
+			"repo":   githubv4.String(o.repo.Repo),
+			"cursor": (*githubv4.String)(nil),
+			"limit":  githubv4.Int(50),
+		}
+	)
+
+	for {
+		var query struct {
+			Base
+
+			Repository struct {
+				Milestones struct {
+					Nodes []milestone
+
+					PageInfo struct {
+						EndCursor   githubv4.String
+						HasNextPage bool
+					}
+				} `graphql:"milestones(first:$limit, after:$cursor, states:[OPEN])"`
+			} `graphql:"repository(name:$repo, owner:$owner)"`
+		}
+
+		if err := o.exec.Execute(ctx, &query, variables); err != nil {
+			return err
+		}
+
+		milestones = append(milestones, query.Repository.Milestones.Nodes...)
+
+		if !query.Repository.Milestones.PageInfo.HasNextPage {
+			break
+		}
+
+		variables["cursor"] = githubv4.NewString(query.Repository.Milestones.PageInfo.EndCursor)
+	}
+
+	var (
+		now = time.Now()
+
+		items        = o.items.NewSnapshot()
+		progress     = o.progress.NewSnapshot()
+		dueTimestamp = o.dueTimestamp.NewSnapshot()
+		daysUntilDue = o.daysUntilDue.NewSnapshot()
+	)
+
+	for _, m := range milestones {
+		items.Set(m.OpenIssues.TotalCount, m.Title, kindIssue, string(githubv4.IssueStateOpen))
+		items.Set(m.ClosedIssues.TotalCount, m.Title, kindIssue, string(githubv4.IssueStateClosed))
+		items.Set(m.OpenPullRequests.TotalCount, m.Title, kindPullRequest, string(githubv4.PullRequestStateOpen))
+		items.Set(m.ClosedPullRequests.TotalCount, m.Title, kindPullRequest, string(githubv4.PullRequestStateClosed))
+		progress.Set(m.ProgressPercentage, m.Title)
+
+		if m.DueOn != nil {
+			dueTimestamp.Set(float64(m.DueOn.Unix()), m.Title)
+			daysUntilDue.Set(m.DueOn.Sub(now).Hours()/24, m.Title)
+		}
+	}
+
+	o.items.Swap(items)
+	o.progress.Swap(progress)
+	o.dueTimestamp.Swap(dueTimestamp)
+	o.daysUntilDue.Swap(daysUntilDue)
+	return nil
+}
+
+// project counts the unarchived items of a project linked to the repository, by project title and status.
+func (o *Milestones) project(ctx context.Context, number int, counts *metrics.GaugeSnapshot) error {
+	variables := map[string]interface{}{
+		"owner":  githubv4.String(o.repo.Owner),
+		"repo":   githubv4.String(o.repo.Repo),
+		"number": githubv4.Int(number),
+		"field":  githubv4.String(o.cfg.Milestones.StatusField),
+		"cursor": (*githubv4.String)(nil),
+		"limit":  githubv4.Int(100),
+	}
+
+	for {
+		var query struct {
+			Base
+
+			Repository struct {
+				ProjectV2 *struct {
+					Title string
+					Items struct {
+						Nodes []struct {
+							IsArchived       bool
+							FieldValueByName *struct {
+								SingleSelect struct {
+									Name string
+								} `graphql:"... on ProjectV2ItemFieldSingleSelectValue"`
+							} `graphql:"fieldValueByName(name:$field)"`
+						}
+
+						PageInfo struct {
+							EndCursor   githubv4.String
+							HasNextPage bool
+						}
+					} `graphql:"items(first:$limit, after:$cursor)"`
+				} `graphql:"projectV2(number:$number)"`
+			} `graphql:"repository(name:$repo, owner:$owner)"`
+		}
+
+		if err := o.exec.Execute(ctx, &query, variables); err != nil {
+			return err
+		}
+
+		project := query.Repository.ProjectV2
+		if project == nil {
+			// the project doesn't exist, or isn't linked to the repository
+			return nil
+		}
+
+		for _, item := range project.Items.Nodes {
+			if item.IsArchived {
+				continue
+			}
+
+			status := noStatus
+			if item.FieldValueByName != nil && item.FieldValueByName.SingleSelect.Name != "" {
+				status = item.FieldValueByName.SingleSelect.Name
+			}
+			counts.Add(1, project.Title, status)
+		}
+
+		if !project.Items.PageInfo.HasNextPage {
+			return nil
+		}
+
+		variables["cursor"] = githubv4.NewString(project.Items.PageInfo.EndCursor)
+	}
+}
+
+func (o *Milestones) Collect(ch chan<- prometheus.Metric) {
+	o.items.Collect(ch)
+	o.progress.Collect(ch)
+	o.dueTimestamp.Collect(ch)
+	o.daysUntilDue.Collect(ch)
+	o.projectItems.Collect(ch)
+}
+
+func (o *Milestones) Describe(ch chan<- *prometheus.Desc) {
+	o.items.Describe(ch)
+	o.progress.Describe(ch)
+	o.dueTimestamp.Describe(ch)
+	o.daysUntilDue.Describe(ch)
+	o.projectItems.Describe(ch)
+}
@@ -1,7 +1,7 @@
 package beats
 
 import (
-	"fmt"
+	"context"
 	"time"
 
 	"github.com/dannykopping/repo-rhythm/pkg/metrics"
@@ -12,102 +12,88 @@ import (
 )
 
 type OpenIssueAge struct {
-	cfg  *rhythm.Config
-	exec *Executor
+	cfg   *rhythm.Config
+	repo  rhythm.Repository
+	exec  *Executor
+	cache *Cache
 
 	age metrics.Distribution
+	// ageByLabel is only populated if label selectors are configured
+	ageByLabel metrics.Distribution
 }
 
 func (o *OpenIssueAge) Name() string {
 	return "open issues age"
 }
 
-func (o *OpenIssueAge) Setup(cfg *rhythm.Config, exec *Executor) {
+func (o *OpenIssueAge) Setup(cfg *rhythm.Config, target *Target) {
 	o.cfg = cfg
-	o.exec = exec
+	o.repo = target.Repository
+	o.exec = target.Exec
+	o.cache = target.Cache
 	o.age = metrics.NewDistribution(
 		metrics.DistributionOpts{
 			Name: "open_issue_age",
 			Help: "Distribution of open issue ages by days",
 			ConstLabels: map[string]string{
-				"owner": cfg.Owner,
-				"repo":  cfg.Repo,
+				"owner": target.Owner,
+				"repo":  target.Repo,
 			},
+			Cumulative: cfg.CumulativeDistributions,
+		},
+		CreateDayBuckets(),
+	)
+	o.ageByLabel = metrics.NewDistribution(
+		metrics.DistributionOpts{
+			Name: "open_issue_age_by_label",
+			Help: "Distribution of open issue ages by selected label by days",
+			ConstLabels: map[string]string{
+				"owner": target.Owner,
+				"repo":  target.Repo,
+			},
+			VariableLabels: []string{"label"},
+			Cumulative:     cfg.CumulativeDistributions,
 		},
 		CreateDayBuckets(),
 	)
 }
 
-func (o *OpenIssueAge) Tick(log.Logger) error {
-	type issue struct {
-		Id        githubv4.ID
-		CreatedAt githubv4.DateTime
+func (o *OpenIssueAge) Tick(ctx context.Context, logger log.Logger) error {
+	if err := o.cache.Sync(ctx, logger); err != nil {
+		return err
 	}
 
-	var (
-		pageSize uint = 100
-		now           = time.Now()
-		fetched       = 0
+	now := time.Now()
 
-		variables = map[string]interface{}{
-			"owner":  githubv4.String(o.cfg.Owner),
-			"repo":   githubv4.String(o.cfg.Repo),
-			"state":  []githubv4.IssueState{githubv4.IssueStateOpen},
-			"cursor": (*githubv4.String)(nil),
-			"limit":  githubv4.Int(pageSize),
+	age := o.age.NewSnapshot()
+	ageByLabel := o.ageByLabel.NewSnapshot()
+	for _, issue := range o.cache.Issues() {
+		if issue.State != githubv4.IssueStateOpen {
+			continue
 		}
 
-		issues []issue
-	)
-
-	for {
-		var query struct {
-			Base
-
-			Repository struct {
-				Issues struct {
-					Nodes []issue
+		hours := now.Sub(issue.CreatedAt)
+		age.Observe(hours.Hours())
 
-					PageInfo struct {
-						EndCursor   githubv4.String
-						HasNextPage bool
-					}
-				} `graphql:"issues(states:$state, first:$limit, after:$cursor)"`
-			} `graphql:"repository(name:$repo, owner:$owner)"`
+		if len(o.cfg.Labels) == 0 {
+			continue
 		}
-
-		err := o.exec.Execute(&query, variables)
-		if err != nil {
-			// don't export metric upon error; the error is handled by the executor
-			return err
-		}
-
-		issues = append(issues, query.Repository.Issues.Nodes...)
-		fetched += len(query.Repository.Issues.Nodes)
-
-		// TODO: logger
-		fmt.Println(fetched)
-
-		if !query.Repository.Issues.PageInfo.HasNextPage {
-			break
+		for _, label := range selectLabels(issue.Labels, o.cfg.Labels) {
+			ageByLabel.Observe(hours.Hours(), label)
 		}
-
-		variables["cursor"] = githubv4.NewString(query.Repository.Issues.PageInfo.EndCursor)
-	}
-
-	o.age.Reset()
-	for _, issue := range issues {
-		hours := now.Sub(issue.CreatedAt.Time)
-		o.age.Observe(hours.Hours())
 	}
 
+	o.age.Swap(age)
+	o.ageByLabel.Swap(ageByLabel)
 	return nil
 }
 
 func (o *OpenIssueAge) Collect(ch chan<- prometheus.Metric) {
 	o.age.Collect(ch)
+	o.ageByLabel.Collect(ch)
 }
 
 func (o *OpenIssueAge) Describe(ch chan<- *prometheus.Desc) {
 	o.age.Describe(ch)
+	o.ageByLabel.Describe(ch)
 }
@@ -1,7 +1,7 @@
 package beats
 
 import (
-	"fmt"
+	"context"
 	"time"
 
 	"github.com/dannykopping/repo-rhythm/pkg/metrics"
@@ -12,103 +12,89 @@ import (
 )
 
 type OpenPullRequestAge struct {
-	cfg  *rhythm.Config
-	exec *Executor
+	cfg   *rhythm.Config
+	repo  rhythm.Repository
+	exec  *Executor
+	cache *Cache
 
 	age metrics.Distribution
+	// ageByLabel is only populated if label selectors are configured
+	ageByLabel metrics.Distribution
 }
 
 func (o *OpenPullRequestAge) Name() string {
 	return "open pull requests age"
 }
 
-func (o *OpenPullRequestAge) Setup(cfg *rhythm.Config, exec *Executor) {
+func (o *OpenPullRequestAge) Setup(cfg *rhythm.Config, target *Target) {
 	o.cfg = cfg
-	o.exec = exec
+	o.repo = target.Repository
+	o.exec = target.Exec
+	o.cache = target.Cache
 
 	o.age = metrics.NewDistribution(
 		metrics.DistributionOpts{
 			Name: "open_pull_request_age",
 			Help: "Distribution of open pull request ages by days",
 			ConstLabels: map[string]string{
-				"owner": cfg.Owner,
-				"repo":  cfg.Repo,
+				"owner": target.Owner,
+				"repo":  target.Repo,
 			},
+			Cumulative: cfg.CumulativeDistributions,
+		},
+		CreateDayBuckets(),
+	)
+	o.ageByLabel = metrics.NewDistribution(
+		metrics.DistributionOpts{
+			Name: "open_pull_request_age_by_label",
+			Help: "Distribution of open pull request ages by selected label by days",
+			ConstLabels: map[string]string{
+				"owner": target.Owner,
+				"repo":  target.Repo,
+			},
+			VariableLabels: []string{"label"},
+			Cumulative:     cfg.CumulativeDistributions,
 		},
 		CreateDayBuckets(),
 	)
 }
 
-func (o *OpenPullRequestAge) Tick(log.Logger) error {
-	type pullRequest struct {
-		Id        githubv4.ID
-		CreatedAt githubv4.DateTime
+func (o *OpenPullRequestAge) Tick(ctx context.Context, logger log.Logger) error {
+	if err := o.cache.Sync(ctx, logger); err != nil {
+		return err
 	}
 
-	var (
-		pageSize uint = 100
-		now           = time.Now()
-		fetched       = 0
+	now := time.Now()
 
-		variables = map[string]interface{}{
-			"owner":  githubv4.String(o.cfg.Owner),
-			"repo":   githubv4.String(o.cfg.Repo),
-			"state":  []githubv4.PullRequestState{githubv4.PullRequestStateOpen},
-			"cursor": (*githubv4.String)(nil),
-			"limit":  githubv4.Int(pageSize),
+	age := o.age.NewSnapshot()
+	ageByLabel := o.ageByLabel.NewSnapshot()
+	for _, pr := range o.cache.PullRequests() {
+		if pr.State != githubv4.PullRequestStateOpen {
+			continue
 		}
 
-		pullRequests []pullRequest
-	)
-
-	for {
-		var query struct {
-			Base
-
-			Repository struct {
-				PullRequests struct {
-					Nodes []pullRequest
+		hours := now.Sub(pr.CreatedAt)
+		age.Observe(hours.Hours())
 
-					PageInfo struct {
-						EndCursor   githubv4.String
-						HasNextPage bool
-					}
-				} `graphql:"pullRequests(states:$state, first:$limit, after:$cursor)"`
-			} `graphql:"repository(name:$repo, owner:$owner)"`
+		if len(o.cfg.Labels) == 0 {
+			continue
 		}
-
-		err := o.exec.Execute(&query, variables)
-		if err != nil {
-			// don't export metric upon error; the error is handled by the executor
-			return err
-		}
-
-		pullRequests = append(pullRequests, query.Repository.PullRequests.Nodes...)
-
-		fetched += len(query.Repository.PullRequests.Nodes)
-		// TODO: logger
-		fmt.Println(fetched)
-
-		if !query.Repository.PullRequests.PageInfo.HasNextPage {
-			break
+		for _, label := range selectLabels(pr.Labels, o.cfg.Labels) {
+			ageByLabel.Observe(hours.Hours(), label)
 		}
-
-		variables["cursor"] = githubv4.NewString(query.Repository.PullRequests.PageInfo.EndCursor)
-	}
-
-	o.age.Reset()
-	for _, issue := range pullRequests {
-		hours := now.Sub(issue.CreatedAt.Time)
-		o.age.Observe(hours.Hours())
 	}
 
+	o.age.Swap(age)
+	o.ageByLabel.Swap(ageByLabel)
 	return nil
 }
 
 func (o *OpenPullRequestAge) Collect(ch chan<- prometheus.Metric) {
 	o.age.Collect(ch)
+	o.ageByLabel.Collect(ch)
 }
 
 func (o *OpenPullRequestAge) Describe(ch chan<- *prometheus.Desc) {
 	o.age.Describe(ch)
+	o.ageByLabel.Describe(ch)
 }
@@ -0,0 +1,102 @@
+package beats
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/dannykopping/repo-rhythm/pkg/metrics"
+	"github.com/dannykopping/repo-rhythm/pkg/rhythm"
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/shurcooL/githubv4"
+)
+
+type PullRequestLifecycle struct {
+	cfg   *rhythm.Config
+	repo  rhythm.Repository
+	exec  *Executor
+	cache *Cache
+
+	timeToMerge metrics.Distribution
+	timeToClose metrics.Distribution
+}
+
+func (o *PullRequestLifecycle) Name() string {
+	return "pull requests lifecycle"
+}
+
+// TickInterval is longer than the default since pull request lifecycles change slowly.
+func (o *PullRequestLifecycle) TickInterval() time.Duration {
+	return time.Hour
+}
+
+func (o *PullRequestLifecycle) Setup(cfg *rhythm.Config, target *Target) {
+	o.cfg = cfg
+	o.repo = target.Repository
+	o.exec = target.Exec
+	o.cache = target.Cache
+
+	o.timeToMerge = metrics.NewDistribution(
+		metrics.DistributionOpts{
+			Name: "pull_request_time_to_merge",
+			Help: "Distribution of merged pull request lifecycles (creation to merge time) by days",
+			ConstLabels: map[string]string{
+				"owner": target.Owner,
+				"repo":  target.Repo,
+			},
+			VariableLabels: []string{"base", "bot"},
+			Cumulative:     cfg.CumulativeDistributions,
+		},
+		CreateDayBuckets(),
+	)
+	o.timeToClose = metrics.NewDistribution(
+		metrics.DistributionOpts{
+			Name: "pull_request_time_to_close",
+			Help: "Distribution of unmerged closed pull request lifecycles (creation to closed time) by days",
+			ConstLabels: map[string]string{
+				"owner": target.Owner,
+				"repo":  target.Repo,
+			},
+			VariableLabels: []string{"base", "bot"},
+			Cumulative:     cfg.CumulativeDistributions,
+		},
+		CreateDayBuckets(),
+	)
+}
+
+func (o *PullRequestLifecycle) Tick(ctx context.Context, logger log.Logger) error {
+	if err := o.cache.Sync(ctx, logger); err != nil {
+		return err
+	}
+
+	timeToMerge := o.timeToMerge.NewSnapshot()
+	timeToClose := o.timeToClose.NewSnapshot()
+
+	for _, pr := range o.cache.PullRequests() {
+		bot := strconv.FormatBool(o.cfg.IsBot(pr.Author.Login, pr.Author.IsBot))
+
+		switch pr.State {
+		case githubv4.PullRequestStateMerged:
+			hours := pr.MergedAt.Sub(pr.CreatedAt)
+			timeToMerge.Observe(hours.Hours(), pr.BaseRefName, bot)
+		case githubv4.PullRequestStateClosed:
+			hours := pr.ClosedAt.Sub(pr.CreatedAt)
+			timeToClose.Observe(hours.Hours(), pr.BaseRefName, bot)
+		}
+	}
+
+	o.timeToMerge.Swap(timeToMerge)
+	o.timeToClose.Swap(timeToClose)
+	return nil
+}
+
+func (o *PullRequestLifecycle) Collect(ch chan<- prometheus.Metric) {
+	o.timeToMerge.Collect(ch)
+	o.timeToClose.Collect(ch)
+}
+
+func (o *PullRequestLifecycle) Describe(ch chan<- *prometheus.Desc) {
+	o.timeToMerge.Describe(ch)
+	o.timeToClose.Describe(ch)
+}
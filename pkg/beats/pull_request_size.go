@@ -0,0 +1,117 @@
+package beats
+
+import (
+	"context"
+	"time"
+
+	"github.com/dannykopping/repo-rhythm/pkg/metrics"
+	"github.com/dannykopping/repo-rhythm/pkg/rhythm"
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/shurcooL/githubv4"
+)
+
+// PullRequestSize measures the size of open pull requests and of those merged within the configured window, by lines
+// added, deleted and changed in total, files changed, and commits. Each is bucketed into the configured named sizes,
+// so that size can be correlated with review and merge times.
+type PullRequestSize struct {
+	cfg   *rhythm.Config
+	repo  rhythm.Repository
+	exec  *Executor
+	cache *Cache
+
+	additions    metrics.Distribution
+	deletions    metrics.Distribution
+	lines        metrics.Distribution
+	changedFiles metrics.Distribution
+	commits      metrics.Distribution
+}
+
+func (o *PullRequestSize) Name() string {
+	return "pull request size"
+}
+
+func (o *PullRequestSize) Setup(cfg *rhythm.Config, target *Target) {
+	o.cfg = cfg
+	o.repo = target.Repository
+	o.exec = target.Exec
+	o.cache = target.Cache
+
+	distribution := func(name, help string, buckets rhythm.Buckets) metrics.Distribution {
+		return metrics.NewDistribution(
+			metrics.DistributionOpts{
+				Name: name,
+				Help: help,
+				ConstLabels: map[string]string{
+					"owner": target.Owner,
+					"repo":  target.Repo,
+				},
+				VariableLabels: []string{"state"},
+				Cumulative:     cfg.CumulativeDistributions,
+			},
+			buckets,
+		)
+	}
+
+	o.additions = distribution("pull_request_additions", "Distribution of lines added by open and recently merged pull requests by size", cfg.PullRequestSize.Lines)
+	o.deletions = distribution("pull_request_deletions", "Distribution of lines deleted by open and recently merged pull requests by size", cfg.PullRequestSize.Lines)
+	o.lines = distribution("pull_request_lines_changed", "Distribution of lines added and deleted by open and recently merged pull requests by size", cfg.PullRequestSize.Lines)
+	o.changedFiles = distribution("pull_request_changed_files", "Distribution of files changed by open and recently merged pull requests by size", cfg.PullRequestSize.Files)
+	o.commits = distribution("pull_request_commits", "Distribution of commits in open and recently merged pull requests by size", cfg.PullRequestSize.Commits)
+}
+
+func (o *PullRequestSize) Tick(ctx context.Context, logger log.Logger) error {
+	if err := o.cache.Sync(ctx, logger); err != nil {
+		return err
+	}
+
+	var (
+		now    = time.Now()
+		window = o.cfg.PullRequestSize.Window
+
+		additions    = o.additions.NewSnapshot()
+		deletions    = o.deletions.NewSnapshot()
+		lines        = o.lines.NewSnapshot()
+		changedFiles = o.changedFiles.NewSnapshot()
+		commits      = o.commits.NewSnapshot()
+	)
+
+	for _, pr := range o.cache.PullRequests() {
+		switch {
+		case pr.State == githubv4.PullRequestStateOpen:
+		case pr.State == githubv4.PullRequestStateMerged && window.Contains(pr.MergedAt, now):
+		default:
+			continue
+		}
+
+		state := string(pr.State)
+		additions.Observe(float64(pr.Additions), state)
+		deletions.Observe(float64(pr.Deletions), state)
+		lines.Observe(float64(pr.Additions+pr.Deletions), state)
+		changedFiles.Observe(float64(pr.ChangedFiles), state)
+		commits.Observe(float64(pr.Commits), state)
+	}
+
+	o.additions.Swap(additions)
+	o.deletions.Swap(deletions)
+	o.lines.Swap(lines)
+	o.changedFiles.Swap(changedFiles)
+	o.commits.Swap(commits)
+	return nil
+}
+
+func (o *PullRequestSize) Collect(ch chan<- prometheus.Metric) {
+	o.additions.Collect(ch)
+	o.deletions.Collect(ch)
+	o.lines.Collect(ch)
+	o.changedFiles.Collect(ch)
+	o.commits.Collect(ch)
+}
+
+func (o *PullRequestSize) Describe(ch chan<- *prometheus.Desc) {
+	o.additions.Describe(ch)
+	o.deletions.Describe(ch)
+	o.lines.Describe(ch)
+	o.changedFiles.Describe(ch)
+	o.commits.Describe(ch)
+}
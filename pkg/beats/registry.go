@@ -0,0 +1,48 @@
+package beats
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// registry maps the names by which beats are selected in config to their constructors.
+var registry = map[string]func() Beat{
+	"count":                  func() Beat { return &Count{} },
+	"open_issue_age":         func() Beat { return &OpenIssueAge{} },
+	"open_pull_request_age":  func() Beat { return &OpenPullRequestAge{} },
+	"closed_issue_lifecycle": func() Beat { return &ClosedIssueLifecycle{} },
+	"pull_request_lifecycle": func() Beat { return &PullRequestLifecycle{} },
+	"first_response":         func() Beat { return &FirstResponse{} },
+	"review_turnaround":      func() Beat { return &ReviewTurnaround{} },
+	"review_requests":        func() Beat { return &ReviewRequests{} },
+	"stale":                  func() Beat { return &Stale{} },
+	"throughput":             func() Beat { return &Throughput{} },
+	"contributors":           func() Beat { return &Contributors{} },
+	"releases":               func() Beat { return &Releases{} },
+	"commits":                func() Beat { return &Commits{} },
+	"checks":                 func() Beat { return &Checks{} },
+	"pull_request_size":      func() Beat { return &PullRequestSize{} },
+	"milestones":             func() Beat { return &Milestones{} },
+	"assignees":              func() Beat { return &Assignees{} },
+}
+
+// Names returns the sorted names of all available beats.
+func Names() []string {
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// New creates the beat registered under the given name.
+func New(name string) (Beat, error) {
+	fn, ok := registry[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown beat %q (available: %s)", name, strings.Join(Names(), ", "))
+	}
+
+	return fn(), nil
+}
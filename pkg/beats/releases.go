@@ -0,0 +1,358 @@
+package beats
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/dannykopping/repo-rhythm/pkg/metrics"
+	"github.com/dannykopping/repo-rhythm/pkg/rhythm"
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/shurcooL/githubv4"
+)
+
+const (
+	releaseStable     = "stable"
+	releasePrerelease = "prerelease"
+)
+
+// Releases measures how often the repository ships: the time since its last release, the intervals between releases,
+// the number of releases within the configured window, and the number of pull requests merged since the last release.
+// Draft releases are ignored. Optionally, tags without a release are counted as stable releases, for repositories
+// which are released by tagging alone. The time since and pull requests merged since the last release are only
+// exported once there has been a release.
+type Releases struct {
+	cfg  *rhythm.Config
+	repo rhythm.Repository
+	exec *Executor
+
+	sinceLast       metrics.GaugeVec
+	releases        *prometheus.GaugeVec
+	intervals       metrics.Distribution
+	mergedSinceLast metrics.GaugeVec
+}
+
+// release is a published release, or a tag if tags are counted as releases.
+type release struct {
+	tag         string
+	prerelease  bool
+	publishedAt time.Time
+}
+
+func (r release) kind() string {
+	if r.prerelease {
+		return releasePrerelease
+	}
+	return releaseStable
+}
+
+func (o *Releases) Name() string {
+	return "releases"
+}
+
+// TickInterval is longer than the default since releases are infrequent.
+func (o *Releases) TickInterval() time.Duration {
+	return 15 * time.Minute
+}
+
+func (o *Releases) Setup(cfg *rhythm.Config, target *Target) {
+	o.cfg = cfg
+	o.repo = target.Repository
+	o.exec = target.Exec
+
+	constLabels := map[string]string{
+		"owner": target.Owner,
+		"repo":  target.Repo,
+	}
+
+	o.sinceLast = metrics.NewGaugeVec(prometheus.GaugeOpts{
+		Name:        "time_since_last_release_seconds",
+		Help:        "Time since the latest release was published",
+		ConstLabels: constLabels,
+	}, nil)
+	o.releases = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name:        "releases",
+		Help:        "Number of releases published within the configured window by type",
+		ConstLabels: constLabels,
+	}, []string{"type"})
+	o.intervals = metrics.NewDistribution(
+		metrics.DistributionOpts{
+			Name:           "release_interval",
+			Help:           "Distribution of intervals between consecutive releases of the same type within the configured window by days",
+			ConstLabels:    constLabels,
+			VariableLabels: []string{"type"},
+			Cumulative:     cfg.CumulativeDistributions,
+		},
+		CreateDayBuckets(),
+	)
+	o.mergedSinceLast = metrics.NewGaugeVec(prometheus.GaugeOpts{
+		Name:        "pull_requests_merged_since_last_release",
+		Help:        "Number of pull requests merged since the latest release was published",
+		ConstLabels: constLabels,
+	}, nil)
+}
+
+func (o *Releases) Tick(ctx context.Context, logger log.Logger) error {
+	var (
+		now   = time.Now()
+		since = o.cfg.Releases.Window.Start(now)
+	)
+
+	releases, err := o.fetchReleases(ctx, since)
+	if err != nil {
+		return err
+	}
+
+	if o.cfg.Releases.Tags {
+		tags, err := o.fetchTags(ctx, since)
+		if err != nil {
+			return err
+		}
+
+		released := make(map[string]struct{}, len(releases))
+		for _, r := range releases {
+			released[r.tag] = struct{}{}
+		}
+		for _, tag := range tags {
+			if _, ok := released[tag.tag]; !ok {
+				releases = append(releases, tag)
+			}
+		}
+	}
+
+	// latest first
+	sort.Slice(releases, func(i, j int) bool {
+		return releases[i].publishedAt.After(releases[j].publishedAt)
+	})
+
+	var (
+		// sinceLast and mergedSinceLast are left empty if nothing has been released, since there is nothing to
+		// measure from
+		sinceLast       = o.sinceLast.NewSnapshot()
+		mergedSinceLast = o.mergedSinceLast.NewSnapshot()
+
+		counts    = map[string]float64{releaseStable: 0, releasePrerelease: 0}
+		intervals = o.intervals.NewSnapshot()
+		// previous holds the previously seen (i.e. next most recent) release of each type
+		previous = make(map[string]release)
+	)
+
+	if len(releases) > 0 {
+		latest := releases[0]
+		merged, err := o.mergedSince(ctx, latest.publishedAt)
+		if err != nil {
+			return err
+		}
+
+		sinceLast.Set(now.Sub(latest.publishedAt).Seconds())
+		mergedSinceLast.Set(merged)
+	}
+
+	for _, r := range releases {
+		if r.publishedAt.Before(since) {
+			// the latest release is fetched even if it is outside the window
+			continue
+		}
+
+		counts[r.kind()]++
+
+		if next, ok := previous[r.kind()]; ok {
+			hours := next.publishedAt.Sub(r.publishedAt)
+			intervals.Observe(hours.Hours(), r.kind())
+		}
+		previous[r.kind()] = r
+	}
+
+	o.sinceLast.Swap(sinceLast)
+	for kind, count := range counts {
+		o.releases.WithLabelValues(kind).Set(count)
+	}
+	o.intervals.Swap(intervals)
+	o.mergedSinceLast.Swap(mergedSinceLast)
+
+	return nil
+}
+
+// fetchReleases pages through the published releases, latest created first, until it reaches one which was both
+// created and published before since. Releases can't be ordered by when they were published, and drafts can be
+// published long after they were created, so those created before since are paged past while they were published
+// after it. The first page is always fetched, so the latest release is found even if it is older.
+func (o *Releases) fetchReleases(ctx context.Context, since time.Time) ([]release, error) {
+	var (
+		releases []release
+
+		variables = map[string]interface{}{
+			"owner":  githubv4.String(o.repo.Owner),
+			"repo":   githubv4.String(o.repo.Repo),
+			"cursor": (*githubv4.String)(nil),
+			"limit":  githubv4.Int(50),
+		}
+	)
+
+	for {
+		var query struct {
+			Base
+
+			Repository struct {
+				Releases struct {
+					Nodes []struct {
+						TagName      string
+						IsDraft      bool
+						IsPrerelease bool
+						CreatedAt    githubv4.DateTime
+						PublishedAt  *githubv4.DateTime
+					}
+
+					PageInfo struct {
+						EndCursor   githubv4.String
+						HasNextPage bool
+					}
+				} `graphql:"releases(first:$limit, after:$cursor, orderBy:{field:CREATED_AT, direction:DESC})"`
+			} `graphql:"repository(name:$repo, owner:$owner)"`
+		}
+
+		if err := o.exec.Execute(ctx, &query, variables); err != nil {
+			return nil, err
+		}
+
+		done := !query.Repository.Releases.PageInfo.HasNextPage
+		for _, node := range query.Repository.Releases.Nodes {
+			if node.IsDraft || node.PublishedAt == nil {
+				continue
+			}
+			if node.CreatedAt.Before(since) && node.PublishedAt.Before(since) {
+				done = true
+			}
+
+			releases = append(releases, release{
+				tag:         node.TagName,
+				prerelease:  node.IsPrerelease,
+				publishedAt: node.PublishedAt.Time,
+			})
+		}
+
+		if done {
+			return releases, nil
+		}
+
+		variables["cursor"] = githubv4.NewString(query.Repository.Releases.PageInfo.EndCursor)
+	}
+}
+
+// fetchTags pages through the tags, latest first, until it reaches those dated before since. A tag is dated by its
+// tagger if it is annotated, or by the commit it points to otherwise.
+func (o *Releases) fetchTags(ctx context.Context, since time.Time) ([]release, error) {
+	var (
+		tags []release
+
+		variables = map[string]interface{}{
+			"owner":     githubv4.String(o.repo.Owner),
+			"repo":      githubv4.String(o.repo.Repo),
+			"refPrefix": githubv4.String("refs/tags/"),
+			"cursor":    (*githubv4.String)(nil),
+			"limit":     githubv4.Int(50),
+		}
+	)
+
+	for {
+		var query struct {
+			Base
+
+			Repository struct {
+				Refs struct {
+					Nodes []struct {
+						Name   string
+						Target struct {
+							Typename string `graphql:"__typename"`
+
+							Commit struct {
+								CommittedDate githubv4.GitTimestamp
+							} `graphql:"... on Commit"`
+							Tag struct {
+								Tagger *struct {
+									Date githubv4.GitTimestamp
+								}
+							} `graphql:"... on Tag"`
+						}
+					}
+
+					PageInfo struct {
+						EndCursor   githubv4.String
+						HasNextPage bool
+					}
+				} `graphql:"refs(refPrefix:$refPrefix, first:$limit, after:$cursor, orderBy:{field:TAG_COMMIT_DATE, direction:DESC})"`
+			} `graphql:"repository(name:$repo, owner:$owner)"`
+		}
+
+		if err := o.exec.Execute(ctx, &query, variables); err != nil {
+			return nil, err
+		}
+
+		done := !query.Repository.Refs.PageInfo.HasNextPage
+		for _, node := range query.Repository.Refs.Nodes {
+			var taggedAt time.Time
+			switch node.Target.Typename {
+			case "Commit":
+				taggedAt = node.Target.Commit.CommittedDate.Time
+			case "Tag":
+				if node.Target.Tag.Tagger != nil {
+					taggedAt = node.Target.Tag.Tagger.Date.Time
+				}
+			}
+
+			if taggedAt.IsZero() {
+				continue
+			}
+			if taggedAt.Before(since) {
+				done = true
+			}
+
+			tags = append(tags, release{
+				tag:         node.Name,
+				publishedAt: taggedAt,
+			})
+		}
+
+		if done {
+			return tags, nil
+		}
+
+		variables["cursor"] = githubv4.NewString(query.Repository.Refs.PageInfo.EndCursor)
+	}
+}
+
+// mergedSince counts the pull requests merged since the given time.
+func (o *Releases) mergedSince(ctx context.Context, since time.Time) (float64, error) {
+	var query struct {
+		Base
+
+		Search struct {
+			IssueCount float64
+		} `graphql:"search(query:$query, type:ISSUE)"`
+	}
+
+	err := o.exec.Execute(ctx, &query, map[string]interface{}{
+		"query": githubv4.String(fmt.Sprintf("repo:%s is:pr is:merged merged:>%s", o.repo, since.UTC().Format(time.RFC3339))),
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return query.Search.IssueCount, nil
+}
+
+func (o *Releases) Collect(ch chan<- prometheus.Metric) {
+	o.sinceLast.Collect(ch)
+	o.releases.Collect(ch)
+	o.intervals.Collect(ch)
+	o.mergedSinceLast.Collect(ch)
+}
+
+func (o *Releases) Describe(ch chan<- *prometheus.Desc) {
+	o.sinceLast.Describe(ch)
+	o.releases.Describe(ch)
+	o.intervals.Describe(ch)
+	o.mergedSinceLast.Describe(ch)
+}
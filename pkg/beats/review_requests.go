@@ -0,0 +1,208 @@
+package beats
+
+import (
+	"context"
+	"time"
+
+	"github.com/dannykopping/repo-rhythm/pkg/metrics"
+	"github.com/dannykopping/repo-rhythm/pkg/rhythm"
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/shurcooL/githubv4"
+)
+
+const (
+	reviewerUser = "user"
+	reviewerTeam = "team"
+)
+
+// ReviewRequests tracks the outstanding review requests of open pull requests, by the user or team whose review
+// was requested. To bound cardinality, only the reviewers with the most outstanding requests are labelled
+// individually; the rest are aggregated as "other".
+type ReviewRequests struct {
+	cfg  *rhythm.Config
+	repo rhythm.Repository
+	exec *Executor
+
+	pending metrics.GaugeVec
+	wait    metrics.Distribution
+}
+
+// requestedReviewer is the GraphQL representation of the user or team whose review was requested.
+type requestedReviewer struct {
+	Typename string `graphql:"__typename"`
+
+	User struct {
+		Login string
+	} `graphql:"... on User"`
+	Team struct {
+		Slug string
+	} `graphql:"... on Team"`
+}
+
+// reviewer identifies the user or team whose review was requested, or is zero for other kinds of reviewer.
+type reviewer struct {
+	kind string
+	name string
+}
+
+func (r requestedReviewer) reviewer() reviewer {
+	switch r.Typename {
+	case "User":
+		return reviewer{kind: reviewerUser, name: r.User.Login}
+	case "Team":
+		return reviewer{kind: reviewerTeam, name: r.Team.Slug}
+	default:
+		return reviewer{}
+	}
+}
+
+func (o *ReviewRequests) Name() string {
+	return "review requests"
+}
+
+func (o *ReviewRequests) TickInterval() time.Duration {
+	return 5 * time.Minute
+}
+
+func (o *ReviewRequests) Setup(cfg *rhythm.Config, target *Target) {
+	o.cfg = cfg
+	o.repo = target.Repository
+	o.exec = target.Exec
+
+	o.pending = metrics.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "pending_review_requests",
+		Help: "Current number of outstanding review requests on open pull requests by reviewer",
+		ConstLabels: map[string]string{
+			"owner": target.Owner,
+			"repo":  target.Repo,
+		},
+	}, []string{"reviewer", "type"})
+	o.wait = metrics.NewDistribution(
+		metrics.DistributionOpts{
+			Name: "pending_review_request_wait",
+			Help: "Distribution of time outstanding review requests on open pull requests have been waiting by days",
+			ConstLabels: map[string]string{
+				"owner": target.Owner,
+				"repo":  target.Repo,
+			},
+			VariableLabels: []string{"reviewer", "type"},
+			Cumulative:     cfg.CumulativeDistributions,
+		},
+		CreateDayBuckets(),
+	)
+}
+
+func (o *ReviewRequests) Tick(ctx context.Context, logger log.Logger) error {
+	var (
+		now = time.Now()
+
+		// waiting holds how long each outstanding request has been waiting, by reviewer
+		waiting = make(map[reviewer][]time.Duration)
+		counts  = make(map[string]int)
+
+		variables = map[string]interface{}{
+			"owner":  githubv4.String(o.repo.Owner),
+			"repo":   githubv4.String(o.repo.Repo),
+			"cursor": (*githubv4.String)(nil),
+			"limit":  githubv4.Int(25),
+		}
+	)
+
+	for {
+		var query struct {
+			Base
+
+			Repository struct {
+				PullRequests struct {
+					Nodes []struct {
+						CreatedAt      githubv4.DateTime
+						ReviewRequests struct {
+							Nodes []struct {
+								RequestedReviewer requestedReviewer
+							}
+						} `graphql:"reviewRequests(first:50)"`
+						TimelineItems struct {
+							Nodes []struct {
+								ReviewRequestedEvent struct {
+									CreatedAt         githubv4.DateTime
+									RequestedReviewer requestedReviewer
+								} `graphql:"... on ReviewRequestedEvent"`
+							}
+						} `graphql:"timelineItems(last:50, itemTypes:[REVIEW_REQUESTED_EVENT])"`
+					}
+
+					PageInfo struct {
+						EndCursor   githubv4.String
+						HasNextPage bool
+					}
+				} `graphql:"pullRequests(first:$limit, after:$cursor, states:[OPEN])"`
+			} `graphql:"repository(name:$repo, owner:$owner)"`
+		}
+
+		if err := o.exec.Execute(ctx, &query, variables); err != nil {
+			return err
+		}
+
+		prs := query.Repository.PullRequests
+		for _, pr := range prs.Nodes {
+			// a review can be requested more than once, so the latest request is the one outstanding
+			requestedAt := make(map[reviewer]time.Time)
+			for _, node := range pr.TimelineItems.Nodes {
+				event := node.ReviewRequestedEvent
+				requestedAt[event.RequestedReviewer.reviewer()] = event.CreatedAt.Time
+			}
+
+			for _, node := range pr.ReviewRequests.Nodes {
+				r := node.RequestedReviewer.reviewer()
+				if r.name == "" {
+					continue
+				}
+
+				since, ok := requestedAt[r]
+				if !ok {
+					// the request predates the timeline items fetched; it can be no older than the pull request
+					since = pr.CreatedAt.Time
+				}
+
+				waiting[r] = append(waiting[r], now.Sub(since))
+				counts[r.kind+"/"+r.name]++
+			}
+		}
+
+		if !prs.PageInfo.HasNextPage {
+			break
+		}
+
+		variables["cursor"] = githubv4.NewString(prs.PageInfo.EndCursor)
+	}
+
+	top := topN(counts, o.cfg.ReviewRequests.TopN)
+	wait := o.wait.NewSnapshot()
+	pending := o.pending.NewSnapshot()
+
+	for r, durations := range waiting {
+		if _, ok := top[r.kind+"/"+r.name]; !ok {
+			r.name = otherLabel
+		}
+
+		for _, d := range durations {
+			wait.Observe(d.Hours(), r.name, r.kind)
+		}
+		pending.Add(float64(len(durations)), r.name, r.kind)
+	}
+
+	o.wait.Swap(wait)
+	o.pending.Swap(pending)
+	return nil
+}
+
+func (o *ReviewRequests) Collect(ch chan<- prometheus.Metric) {
+	o.pending.Collect(ch)
+	o.wait.Collect(ch)
+}
+
+func (o *ReviewRequests) Describe(ch chan<- *prometheus.Desc) {
+	o.pending.Describe(ch)
+	o.wait.Describe(ch)
+}
@@ -0,0 +1,304 @@
+package beats
+
+import (
+	"context"
+	"time"
+
+	"github.com/dannykopping/repo-rhythm/pkg/metrics"
+	"github.com/dannykopping/repo-rhythm/pkg/rhythm"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/shurcooL/githubv4"
+)
+
+// ReviewTurnaround measures reviewer latency: the time from a pull request becoming ready for review to its first
+// review and first approval, and the number of rounds of changes requested before it was merged. Reviews by the
+// author or by bots are ignored. Only pull requests created within the configured window, and not themselves
+// created by bots, are considered.
+type ReviewTurnaround struct {
+	cfg   *rhythm.Config
+	repo  rhythm.Repository
+	exec  *Executor
+	cache *Cache
+
+	// reviews remembers what is known about each pull request, by number, so that their timelines
+	// are only fetched again once they are updated
+	reviews map[int]reviewSummary
+
+	timeToFirstReview   metrics.Distribution
+	timeToFirstApproval metrics.Distribution
+	changesRequested    metrics.Distribution
+}
+
+type reviewSummary struct {
+	updatedAt time.Time
+	// readyAt is zero if the pull request is still a draft
+	readyAt time.Time
+	// firstReviewAt and firstApprovalAt are zero if there has been no such review
+	firstReviewAt   time.Time
+	firstApprovalAt time.Time
+	// changesRequested is the number of rounds of changes requested; consecutive reviews requesting changes count
+	// as a single round until a commit is pushed or the pull request is approved
+	changesRequested int
+}
+
+func (o *ReviewTurnaround) Name() string {
+	return "review turnaround"
+}
+
+func (o *ReviewTurnaround) TickInterval() time.Duration {
+	return 10 * time.Minute
+}
+
+func (o *ReviewTurnaround) Setup(cfg *rhythm.Config, target *Target) {
+	o.cfg = cfg
+	o.repo = target.Repository
+	o.exec = target.Exec
+	o.cache = target.Cache
+	o.reviews = make(map[int]reviewSummary)
+
+	o.timeToFirstReview = metrics.NewDistribution(
+		metrics.DistributionOpts{
+			Name: "pull_request_time_to_first_review",
+			Help: "Distribution of time from pull requests becoming ready for review to their first review by days",
+			ConstLabels: map[string]string{
+				"owner": target.Owner,
+				"repo":  target.Repo,
+			},
+			Cumulative: cfg.CumulativeDistributions,
+		},
+		CreateDayBuckets(),
+	)
+	o.timeToFirstApproval = metrics.NewDistribution(
+		metrics.DistributionOpts{
+			Name: "pull_request_time_to_first_approval",
+			Help: "Distribution of time from pull requests becoming ready for review to their first approval by days",
+			ConstLabels: map[string]string{
+				"owner": target.Owner,
+				"repo":  target.Repo,
+			},
+			Cumulative: cfg.CumulativeDistributions,
+		},
+		CreateDayBuckets(),
+	)
+	o.changesRequested = metrics.NewDistribution(
+		metrics.DistributionOpts{
+			Name: "pull_request_changes_requested_rounds",
+			Help: "Distribution of the number of rounds of changes requested before merged pull requests were merged, where a round ends with a new commit or an approval",
+			ConstLabels: map[string]string{
+				"owner": target.Owner,
+				"repo":  target.Repo,
+			},
+			Cumulative: cfg.CumulativeDistributions,
+		},
+		map[string]float64{
+			"0":  0,
+			"1":  1,
+			"2":  2,
+			"3":  3,
+			"5":  5,
+			"10": 10,
+		},
+	)
+}
+
+func (o *ReviewTurnaround) Tick(ctx context.Context, logger log.Logger) error {
+	if err := o.cache.Sync(ctx, logger); err != nil {
+		return err
+	}
+
+	var (
+		now    = time.Now()
+		window = o.cfg.ReviewTurnaround.Window
+
+		timeToFirstReview   = o.timeToFirstReview.NewSnapshot()
+		timeToFirstApproval = o.timeToFirstApproval.NewSnapshot()
+		changesRequested    = o.changesRequested.NewSnapshot()
+		visited             = make(map[int]struct{})
+		fetched             int
+	)
+
+	for _, pr := range o.cache.PullRequests() {
+		if !window.Contains(pr.CreatedAt, now) || o.cfg.IsBot(pr.Author.Login, pr.Author.IsBot) {
+			continue
+		}
+
+		visited[pr.Number] = struct{}{}
+
+		summary, ok := o.reviews[pr.Number]
+		if !ok || pr.UpdatedAt.After(summary.updatedAt) {
+			var err error
+			summary, err = o.summarise(ctx, pr)
+			if err != nil {
+				return err
+			}
+
+			o.reviews[pr.Number] = summary
+			fetched++
+		}
+
+		if summary.readyAt.IsZero() {
+			continue
+		}
+
+		if !summary.firstReviewAt.IsZero() {
+			hours := sinceReady(summary.readyAt, summary.firstReviewAt)
+			timeToFirstReview.Observe(hours.Hours())
+		}
+		if !summary.firstApprovalAt.IsZero() {
+			hours := sinceReady(summary.readyAt, summary.firstApprovalAt)
+			timeToFirstApproval.Observe(hours.Hours())
+		}
+		if pr.State == githubv4.PullRequestStateMerged {
+			changesRequested.Observe(float64(summary.changesRequested))
+		}
+	}
+
+	level.Debug(logger).Log("msg", "fetched timelines", "fetched", fetched)
+
+	// forget about pull requests which have since fallen out of the window
+	for number := range o.reviews {
+		if _, ok := visited[number]; !ok {
+			delete(o.reviews, number)
+		}
+	}
+
+	o.timeToFirstReview.Swap(timeToFirstReview)
+	o.timeToFirstApproval.Swap(timeToFirstApproval)
+	o.changesRequested.Swap(changesRequested)
+	return nil
+}
+
+// sinceReady returns the time between a pull request becoming ready for review and a review.
+// Reviews can be submitted on drafts, in which case no time was spent waiting.
+func sinceReady(readyAt, reviewedAt time.Time) time.Duration {
+	if reviewedAt.Before(readyAt) {
+		return 0
+	}
+	return reviewedAt.Sub(readyAt)
+}
+
+// summarise pages through the timeline of a pull request to find when it became ready for review,
+// when it was first reviewed and approved, and how many rounds of changes were requested.
+func (o *ReviewTurnaround) summarise(ctx context.Context, pr PullRequest) (reviewSummary, error) {
+	summary := reviewSummary{
+		updatedAt: pr.UpdatedAt,
+	}
+
+	var (
+		isDraft    bool
+		readyEvent time.Time
+		// inRound is set while changes have been requested but not yet addressed by a commit or approval
+		inRound bool
+
+		variables = map[string]interface{}{
+			"owner":  githubv4.String(o.repo.Owner),
+			"repo":   githubv4.String(o.repo.Repo),
+			"number": githubv4.Int(pr.Number),
+			"cursor": (*githubv4.String)(nil),
+			"limit":  githubv4.Int(100),
+		}
+	)
+
+	for {
+		var query struct {
+			Base
+
+			Repository struct {
+				PullRequest struct {
+					IsDraft       bool
+					TimelineItems struct {
+						Nodes []struct {
+							Typename string `graphql:"__typename"`
+
+							ReadyForReviewEvent struct {
+								CreatedAt githubv4.DateTime
+							} `graphql:"... on ReadyForReviewEvent"`
+							PullRequestReview struct {
+								Author      actor
+								State       githubv4.PullRequestReviewState
+								SubmittedAt *githubv4.DateTime
+							} `graphql:"... on PullRequestReview"`
+						}
+
+						PageInfo struct {
+							EndCursor   githubv4.String
+							HasNextPage bool
+						}
+					} `graphql:"timelineItems(first:$limit, after:$cursor, itemTypes:[READY_FOR_REVIEW_EVENT, PULL_REQUEST_REVIEW, PULL_REQUEST_COMMIT])"`
+				} `graphql:"pullRequest(number:$number)"`
+			} `graphql:"repository(name:$repo, owner:$owner)"`
+		}
+
+		if err := o.exec.Execute(ctx, &query, variables); err != nil {
+			return summary, err
+		}
+
+		isDraft = query.Repository.PullRequest.IsDraft
+		items := query.Repository.PullRequest.TimelineItems
+
+		for _, node := range items.Nodes {
+			switch node.Typename {
+			case "ReadyForReviewEvent":
+				if readyEvent.IsZero() {
+					readyEvent = node.ReadyForReviewEvent.CreatedAt.Time
+				}
+			case "PullRequestCommit":
+				inRound = false
+			case "PullRequestReview":
+				review := node.PullRequestReview
+				who := review.Author.actor()
+				if review.SubmittedAt == nil || who.Login == "" || who.Login == pr.Author.Login || o.cfg.IsBot(who.Login, who.IsBot) {
+					continue
+				}
+
+				submittedAt := review.SubmittedAt.Time
+				if summary.firstReviewAt.IsZero() {
+					summary.firstReviewAt = submittedAt
+				}
+
+				switch review.State {
+				case githubv4.PullRequestReviewStateApproved:
+					if summary.firstApprovalAt.IsZero() {
+						summary.firstApprovalAt = submittedAt
+					}
+					inRound = false
+				case githubv4.PullRequestReviewStateChangesRequested:
+					if !inRound {
+						summary.changesRequested++
+					}
+					inRound = true
+				}
+			}
+		}
+
+		if !items.PageInfo.HasNextPage {
+			break
+		}
+
+		variables["cursor"] = githubv4.NewString(items.PageInfo.EndCursor)
+	}
+
+	switch {
+	case !readyEvent.IsZero():
+		// the pull request was opened as a draft
+		summary.readyAt = readyEvent
+	case !isDraft:
+		summary.readyAt = pr.CreatedAt
+	}
+
+	return summary, nil
+}
+
+func (o *ReviewTurnaround) Collect(ch chan<- prometheus.Metric) {
+	o.timeToFirstReview.Collect(ch)
+	o.timeToFirstApproval.Collect(ch)
+	o.changesRequested.Collect(ch)
+}
+
+func (o *ReviewTurnaround) Describe(ch chan<- *prometheus.Desc) {
+	o.timeToFirstReview.Describe(ch)
+	o.timeToFirstApproval.Describe(ch)
+	o.changesRequested.Describe(ch)
+}
@@ -0,0 +1,316 @@
+package beats
+
+import (
+	"context"
+	"time"
+
+	"github.com/dannykopping/repo-rhythm/pkg/metrics"
+	"github.com/dannykopping/repo-rhythm/pkg/rhythm"
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/shurcooL/githubv4"
+)
+
+const (
+	// activityUpdate is any update to an issue or pull request, including by bots.
+	activityUpdate = "update"
+	// activityComment is the latest comment by anyone other than a bot, or the creation of the issue or pull request
+	// if there is no such comment.
+	activityComment = "comment"
+)
+
+// Stale measures how long open issues and pull requests have gone without activity, and counts those which have
+// been inactive for longer than each of the configured thresholds.
+//
+// Activity is measured both as the last update and as the last comment: an update can be as insignificant as a bot
+// applying a label, whereas a comment reflects someone engaging with the issue or pull request.
+type Stale struct {
+	cfg   *rhythm.Config
+	repo  rhythm.Repository
+	exec  *Executor
+	cache *Cache
+
+	// lastComments remembers the latest comment by anyone other than a bot on issues and pull requests whose recent
+	// comments are all by bots, by number, so that their earlier comments are only fetched again once they are updated
+	lastComments map[int]lastComment
+
+	inactivity metrics.Distribution
+	stale      *prometheus.GaugeVec
+}
+
+type lastComment struct {
+	updatedAt time.Time
+	// at is when the issue or pull request was created if it has no comment by anyone other than a bot
+	at time.Time
+}
+
+// staleSeries identifies a series of the stale gauge; labelled is only used if stale labels are configured.
+type staleSeries struct {
+	kind      string
+	activity  string
+	threshold string
+	labelled  string
+}
+
+func (o *Stale) Name() string {
+	return "stale"
+}
+
+func (o *Stale) Setup(cfg *rhythm.Config, target *Target) {
+	o.cfg = cfg
+	o.repo = target.Repository
+	o.exec = target.Exec
+	o.cache = target.Cache
+	o.lastComments = make(map[int]lastComment)
+
+	o.inactivity = metrics.NewDistribution(
+		metrics.DistributionOpts{
+			Name: "time_since_last_activity",
+			Help: "Distribution of time since the last activity on open issues and pull requests by days",
+			ConstLabels: map[string]string{
+				"owner": target.Owner,
+				"repo":  target.Repo,
+			},
+			VariableLabels: []string{"kind", "activity"},
+			Cumulative:     cfg.CumulativeDistributions,
+		},
+		CreateDayBuckets(),
+	)
+
+	labels := []string{"kind", "activity", "threshold"}
+	if len(cfg.Stale.Labels) > 0 {
+		labels = append(labels, "stale_label")
+	}
+	o.stale = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "stale",
+		Help: "Current number of open issues and pull requests which have been inactive for longer than each threshold",
+		ConstLabels: map[string]string{
+			"owner": target.Owner,
+			"repo":  target.Repo,
+		},
+	}, labels)
+}
+
+func (o *Stale) Tick(ctx context.Context, logger log.Logger) error {
+	if err := o.cache.Sync(ctx, logger); err != nil {
+		return err
+	}
+
+	var (
+		now      = time.Now()
+		byLabel  = len(o.cfg.Stale.Labels) > 0
+		labelled = []string{"false"}
+
+		inactivity = o.inactivity.NewSnapshot()
+		counts     = make(map[staleSeries]float64)
+		visited    = make(map[int]struct{})
+	)
+
+	if byLabel {
+		labelled = append(labelled, "true")
+	}
+
+	// every series is reported, even if zero, so that thresholds which nothing exceeds are visible
+	for _, kind := range []string{kindIssue, kindPullRequest} {
+		for _, activity := range []string{activityUpdate, activityComment} {
+			for _, threshold := range o.cfg.Stale.Thresholds {
+				for _, l := range labelled {
+					counts[staleSeries{kind, activity, threshold.String(), l}] = 0
+				}
+			}
+		}
+	}
+
+	observe := func(kind string, number int, createdAt, updatedAt time.Time, labels []string, comments []Comment) error {
+		lastComment, err := o.lastComment(ctx, kind, number, createdAt, updatedAt, comments, visited)
+		if err != nil {
+			return err
+		}
+
+		l := "false"
+		if byLabel && o.staleLabelled(labels) {
+			l = "true"
+		}
+
+		for activity, at := range map[string]time.Time{activityUpdate: updatedAt, activityComment: lastComment} {
+			inactive := now.Sub(at)
+			inactivity.Observe(inactive.Hours(), kind, activity)
+
+			for _, threshold := range o.cfg.Stale.Thresholds {
+				if inactive >= time.Duration(threshold) {
+					counts[staleSeries{kind, activity, threshold.String(), l}]++
+				}
+			}
+		}
+
+		return nil
+	}
+
+	for _, issue := range o.cache.Issues() {
+		if issue.State != githubv4.IssueStateOpen {
+			continue
+		}
+
+		if err := observe(kindIssue, issue.Number, issue.CreatedAt, issue.UpdatedAt, issue.Labels, issue.RecentComments); err != nil {
+			return err
+		}
+	}
+	for _, pr := range o.cache.PullRequests() {
+		if pr.State != githubv4.PullRequestStateOpen {
+			continue
+		}
+
+		if err := observe(kindPullRequest, pr.Number, pr.CreatedAt, pr.UpdatedAt, pr.Labels, pr.RecentComments); err != nil {
+			return err
+		}
+	}
+
+	// forget about issues and pull requests which have since been closed or commented on by anyone other than a bot
+	for number := range o.lastComments {
+		if _, ok := visited[number]; !ok {
+			delete(o.lastComments, number)
+		}
+	}
+
+	o.inactivity.Swap(inactivity)
+	for series, count := range counts {
+		values := []string{series.kind, series.activity, series.threshold}
+		if byLabel {
+			values = append(values, series.labelled)
+		}
+		o.stale.WithLabelValues(values...).Set(count)
+	}
+
+	return nil
+}
+
+// lastComment returns when the latest comment by anyone other than a bot was made on an issue or pull request, or
+// when it was created if there is no such comment. Only its recent comments are cached, so if those are all by bots,
+// its earlier comments are fetched; the numbers of those fetched are added to visited.
+func (o *Stale) lastComment(ctx context.Context, kind string, number int, createdAt, updatedAt time.Time, comments []Comment, visited map[int]struct{}) (time.Time, error) {
+	var latest time.Time
+	for _, c := range comments {
+		if !o.cfg.IsBot(c.Author.Login, c.Author.IsBot) && c.CreatedAt.After(latest) {
+			latest = c.CreatedAt
+		}
+	}
+
+	switch {
+	case !latest.IsZero():
+		return latest, nil
+	case len(comments) < recentComments:
+		// every comment is cached, so there is no comment by anyone other than a bot
+		return createdAt, nil
+	}
+
+	visited[number] = struct{}{}
+
+	last, ok := o.lastComments[number]
+	if !ok || updatedAt.After(last.updatedAt) {
+		at, err := o.fetchLastComment(ctx, kind, number)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if at.IsZero() {
+			at = createdAt
+		}
+
+		last = lastComment{updatedAt: updatedAt, at: at}
+		o.lastComments[number] = last
+	}
+
+	return last.at, nil
+}
+
+// fetchLastComment pages backwards through the comments of an issue or pull request until it finds one by anyone
+// other than a bot. It returns the zero time if there is no such comment.
+func (o *Stale) fetchLastComment(ctx context.Context, kind string, number int) (time.Time, error) {
+	type connection struct {
+		comments
+
+		PageInfo struct {
+			StartCursor     githubv4.String
+			HasPreviousPage bool
+		}
+	}
+
+	variables := map[string]interface{}{
+		"owner":  githubv4.String(o.repo.Owner),
+		"repo":   githubv4.String(o.repo.Repo),
+		"number": githubv4.Int(number),
+		"cursor": (*githubv4.String)(nil),
+		"limit":  githubv4.Int(50),
+	}
+
+	for {
+		var conn connection
+
+		if kind == kindIssue {
+			var query struct {
+				Base
+
+				Repository struct {
+					Issue struct {
+						Comments connection `graphql:"comments(last:$limit, before:$cursor)"`
+					} `graphql:"issue(number:$number)"`
+				} `graphql:"repository(name:$repo, owner:$owner)"`
+			}
+
+			if err := o.exec.Execute(ctx, &query, variables); err != nil {
+				return time.Time{}, err
+			}
+			conn = query.Repository.Issue.Comments
+		} else {
+			var query struct {
+				Base
+
+				Repository struct {
+					PullRequest struct {
+						Comments connection `graphql:"comments(last:$limit, before:$cursor)"`
+					} `graphql:"pullRequest(number:$number)"`
+				} `graphql:"repository(name:$repo, owner:$owner)"`
+			}
+
+			if err := o.exec.Execute(ctx, &query, variables); err != nil {
+				return time.Time{}, err
+			}
+			conn = query.Repository.PullRequest.Comments
+		}
+
+		// comments are oldest first, so the latest is found by searching from the end
+		cs := conn.comments.comments()
+		for i := len(cs) - 1; i >= 0; i-- {
+			if !o.cfg.IsBot(cs[i].Author.Login, cs[i].Author.IsBot) {
+				return cs[i].CreatedAt, nil
+			}
+		}
+
+		if !conn.PageInfo.HasPreviousPage {
+			return time.Time{}, nil
+		}
+
+		variables["cursor"] = githubv4.NewString(conn.PageInfo.StartCursor)
+	}
+}
+
+// staleLabelled reports whether any of the given labels marks an issue or pull request as stale.
+func (o *Stale) staleLabelled(labels []string) bool {
+	for _, label := range labels {
+		for _, selector := range o.cfg.Stale.Labels {
+			if selector.Match(label) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (o *Stale) Collect(ch chan<- prometheus.Metric) {
+	o.inactivity.Collect(ch)
+	o.stale.Collect(ch)
+}
+
+func (o *Stale) Describe(ch chan<- *prometheus.Desc) {
+	o.inactivity.Describe(ch)
+	o.stale.Describe(ch)
+}
@@ -0,0 +1,102 @@
+package beats
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/dannykopping/repo-rhythm/pkg/rhythm"
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/shurcooL/githubv4"
+)
+
+// Throughput counts the issues and pull requests opened, closed and merged within each of the configured windows,
+// so that inflow can be compared with outflow. Unlike most beats, it uses search queries bounded by date rather than
+// the cache, so that each count costs a single query regardless of the size of the repository.
+type Throughput struct {
+	cfg  *rhythm.Config
+	repo rhythm.Repository
+	exec *Executor
+
+	throughput *prometheus.GaugeVec
+}
+
+func (o *Throughput) Name() string {
+	return "throughput"
+}
+
+func (o *Throughput) TickInterval() time.Duration {
+	return 10 * time.Minute
+}
+
+func (o *Throughput) Setup(cfg *rhythm.Config, target *Target) {
+	o.cfg = cfg
+	o.repo = target.Repository
+	o.exec = target.Exec
+
+	o.throughput = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "throughput",
+		Help: "Number of issues and pull requests opened, closed and merged within each window",
+		ConstLabels: map[string]string{
+			"owner": target.Owner,
+			"repo":  target.Repo,
+		},
+	}, []string{"kind", "event", "window"})
+}
+
+func (o *Throughput) Tick(ctx context.Context, logger log.Logger) error {
+	type count struct {
+		IssueCount float64
+	}
+
+	var query struct {
+		Base
+
+		IssuesOpened       count `graphql:"issuesOpened: search(query:$issuesOpened, type:ISSUE)"`
+		IssuesClosed       count `graphql:"issuesClosed: search(query:$issuesClosed, type:ISSUE)"`
+		PullRequestsOpened count `graphql:"pullRequestsOpened: search(query:$pullRequestsOpened, type:ISSUE)"`
+		PullRequestsClosed count `graphql:"pullRequestsClosed: search(query:$pullRequestsClosed, type:ISSUE)"`
+		PullRequestsMerged count `graphql:"pullRequestsMerged: search(query:$pullRequestsMerged, type:ISSUE)"`
+	}
+
+	now := time.Now()
+
+	for _, window := range o.cfg.Throughput.Windows {
+		search := func(qualifiers, field string) githubv4.String {
+			q := fmt.Sprintf("repo:%s %s", o.repo, qualifiers)
+			if window != rhythm.AllTime {
+				q += fmt.Sprintf(" %s:>=%s", field, window.Start(now).UTC().Format(time.RFC3339))
+			}
+			return githubv4.String(q)
+		}
+
+		err := o.exec.Execute(ctx, &query, map[string]interface{}{
+			"issuesOpened":       search("is:issue", "created"),
+			"issuesClosed":       search("is:issue is:closed", "closed"),
+			"pullRequestsOpened": search("is:pr", "created"),
+			// pull requests which were merged are counted separately
+			"pullRequestsClosed": search("is:pr is:closed is:unmerged", "closed"),
+			"pullRequestsMerged": search("is:pr is:merged", "merged"),
+		})
+		if err != nil {
+			return err
+		}
+
+		o.throughput.WithLabelValues(kindIssue, "opened", window.String()).Set(query.IssuesOpened.IssueCount)
+		o.throughput.WithLabelValues(kindIssue, "closed", window.String()).Set(query.IssuesClosed.IssueCount)
+		o.throughput.WithLabelValues(kindPullRequest, "opened", window.String()).Set(query.PullRequestsOpened.IssueCount)
+		o.throughput.WithLabelValues(kindPullRequest, "closed", window.String()).Set(query.PullRequestsClosed.IssueCount)
+		o.throughput.WithLabelValues(kindPullRequest, "merged", window.String()).Set(query.PullRequestsMerged.IssueCount)
+	}
+
+	return nil
+}
+
+func (o *Throughput) Collect(ch chan<- prometheus.Metric) {
+	o.throughput.Collect(ch)
+}
+
+func (o *Throughput) Describe(ch chan<- *prometheus.Desc) {
+	o.throughput.Describe(ch)
+}
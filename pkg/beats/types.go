@@ -1,31 +1,55 @@
 package beats
 
 import (
+	"context"
 	"time"
 
 	"github.com/dannykopping/repo-rhythm/pkg/rhythm"
 	"github.com/go-kit/log"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/shurcooL/githubv4"
 )
 
 type Beat interface {
 	prometheus.Collector
 
 	Name() string
-	Setup(*rhythm.Config, *Executor)
-	Tick(log log.Logger) error
+	Setup(*rhythm.Config, *Target)
+	// Tick fetches the beat's data and updates its metrics.
+	// It should return promptly once the context is done. If it fails, it returns the error for the runner to log,
+	// and leaves its metrics as of the last successful tick rather than exporting a partial result.
+	Tick(ctx context.Context, log log.Logger) error
+}
+
+// WithTickInterval is implemented by beats which should tick at a different interval to the configured default,
+// e.g. because they are expensive to run. Intervals set per beat in config take precedence.
+type WithTickInterval interface {
+	TickInterval() time.Duration
+}
+
+// Target is a repository monitored by a set of beats, along with the dependencies shared by those beats.
+type Target struct {
+	rhythm.Repository
+
+	Exec  *Executor
+	Cache *Cache
 }
 
 type Base struct {
 	RateLimit RateLimit
 }
 
-func (b *Base) RateLimitRemaining() int {
-	return b.RateLimit.Remaining
+func (b *Base) RateLimitState() RateLimit {
+	return b.RateLimit
 }
 
+// RateLimit is the GraphQL API rate limit status, as of the query which requested it.
 type RateLimit struct {
+	// Cost is the number of points the query consumed.
+	Cost      int
 	Remaining int
+	ResetAt   githubv4.DateTime
+	Limit     int
 }
 
 func CreateDayBuckets() map[string]float64 {
@@ -0,0 +1,185 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/dannykopping/repo-rhythm/pkg/beats"
+	"github.com/dannykopping/repo-rhythm/pkg/rhythm"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/shurcooL/githubv4"
+)
+
+// Discoverer lists the repositories belonging to organizations or users, filtered according to config.
+type Discoverer struct {
+	cfg    *rhythm.DiscoveryConfig
+	exec   *beats.Executor
+	logger log.Logger
+
+	mu sync.Mutex
+	// last holds the most recent successful result per owner, so that a failed discovery
+	// does not cause all of an owner's repositories to stop being monitored
+	last map[string][]rhythm.Repository
+}
+
+func NewDiscoverer(cfg *rhythm.DiscoveryConfig, exec *beats.Executor, logger log.Logger) *Discoverer {
+	return &Discoverer{
+		cfg:    cfg,
+		exec:   exec,
+		logger: logger,
+		last:   make(map[string][]rhythm.Repository),
+	}
+}
+
+// Discover returns the repositories matching the configured filters across all owners.
+// If an owner's repositories cannot be listed, the previous result for that owner is used instead, and the failure
+// is returned alongside the repositories.
+func (d *Discoverer) Discover(ctx context.Context) ([]rhythm.Repository, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var (
+		repos []rhythm.Repository
+		errs  []error
+	)
+	for _, owner := range d.cfg.Owners {
+		found, err := d.discover(ctx, owner)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("owner %q: %w", owner.Owner, err))
+			found = d.last[owner.Owner]
+		} else {
+			level.Debug(d.logger).Log("msg", "repository discovery succeeded", "owner", owner.Owner, "repositories", len(found))
+			d.last[owner.Owner] = found
+		}
+
+		repos = append(repos, found...)
+	}
+
+	return repos, errors.Join(errs...)
+}
+
+func (d *Discoverer) discover(ctx context.Context, owner rhythm.OwnerConfig) ([]rhythm.Repository, error) {
+	type repository struct {
+		Name             string
+		IsArchived       bool
+		IsFork           bool
+		Visibility       githubv4.RepositoryVisibility
+		RepositoryTopics struct {
+			Nodes []struct {
+				Topic struct {
+					Name string
+				}
+			}
+		} `graphql:"repositoryTopics(first:100)"`
+	}
+
+	var (
+		pageSize uint = 100
+
+		variables = map[string]interface{}{
+			"owner":  githubv4.String(owner.Owner),
+			"cursor": (*githubv4.String)(nil),
+			"limit":  githubv4.Int(pageSize),
+		}
+
+		repos []rhythm.Repository
+	)
+
+	for {
+		var query struct {
+			beats.Base
+
+			RepositoryOwner struct {
+				Repositories struct {
+					Nodes []repository
+
+					PageInfo struct {
+						EndCursor   githubv4.String
+						HasNextPage bool
+					}
+				} `graphql:"repositories(first:$limit, after:$cursor, ownerAffiliations:[OWNER])"`
+			} `graphql:"repositoryOwner(login:$owner)"`
+		}
+
+		err := d.exec.Execute(ctx, &query, variables)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, repo := range query.RepositoryOwner.Repositories.Nodes {
+			var topics []string
+			for _, node := range repo.RepositoryTopics.Nodes {
+				topics = append(topics, node.Topic.Name)
+			}
+
+			if !matches(owner, repo.Name, repo.IsArchived, repo.IsFork, string(repo.Visibility), topics) {
+				continue
+			}
+
+			repos = append(repos, rhythm.Repository{Owner: owner.Owner, Repo: repo.Name})
+		}
+
+		if !query.RepositoryOwner.Repositories.PageInfo.HasNextPage {
+			break
+		}
+
+		variables["cursor"] = githubv4.NewString(query.RepositoryOwner.Repositories.PageInfo.EndCursor)
+	}
+
+	return repos, nil
+}
+
+func matches(owner rhythm.OwnerConfig, name string, archived, fork bool, visibility string, topics []string) bool {
+	if archived && !owner.Archived {
+		return false
+	}
+	if fork && !owner.Forks {
+		return false
+	}
+
+	if len(owner.Visibility) > 0 && !containsFold(owner.Visibility, visibility) {
+		return false
+	}
+
+	if len(owner.Topics) > 0 {
+		var found bool
+		for _, topic := range topics {
+			if containsFold(owner.Topics, topic) {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	if len(owner.Include) > 0 && !matchAny(owner.Include, name) {
+		return false
+	}
+
+	return !matchAny(owner.Exclude, name)
+}
+
+func matchAny(patterns []rhythm.Pattern, name string) bool {
+	for _, p := range patterns {
+		if p.Match(name) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -1,9 +1,12 @@
 package metrics
 
 import (
+	"fmt"
 	"math"
+	"sort"
+	"strings"
+	"sync/atomic"
 
-	"facette.io/natsort"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
@@ -11,92 +14,170 @@ import (
 // It differs from a histogram in two key ways:
 // 1. It does not collect observations over time, only a snapshot of the current state.
 // 2. Its buckets are strings, not float64s, so that they are easier to diagram.
+//
+// Observations are made into a Snapshot, which atomically replaces the current state of the distribution once
+// complete; a scrape therefore never sees a partially-built distribution.
+//
+// If the distribution has variable labels, each distinct combination of label values observed is exported as a
+// separate set of buckets. Otherwise, all buckets are exported even if nothing was observed.
 type Distribution interface {
 	prometheus.Collector
 
-	// Observe adds a single observation to the distribution in the appropriate bucket.
-	Observe(float64)
-	Reset()
+	// NewSnapshot returns an empty snapshot, to be published with Swap once all observations have been made.
+	NewSnapshot() *Snapshot
+	// Swap replaces the current state of the distribution with the given snapshot.
+	Swap(*Snapshot)
 }
 
-type DistributionOpts prometheus.Opts
+type DistributionOpts struct {
+	Namespace   string
+	Subsystem   string
+	Name        string
+	Help        string
+	ConstLabels prometheus.Labels
+	// VariableLabels are the names of labels whose values are given with each observation.
+	VariableLabels []string
+
+	// Cumulative causes each bucket to count all observations less than or equal to its upper bound,
+	// like a histogram's "le" buckets, rather than only those greater than the previous bucket's upper bound.
+	Cumulative bool
+}
 
 const infBucket = "+Inf"
 
-// NewDistribution creates
+// NewDistribution creates a Distribution with the given buckets, which map bucket names to their upper bounds.
+// Unless one of the buckets is unbounded, a "+Inf" bucket is added to catch all observations above the highest bound.
 func NewDistribution(opts DistributionOpts, buckets map[string]float64) Distribution {
 	dist := &distribution{
-		buckets: make(map[string]*bucket, len(buckets)),
+		desc: prometheus.NewDesc(
+			prometheus.BuildFQName(opts.Namespace, opts.Subsystem, opts.Name),
+			opts.Help,
+			append(append([]string{}, opts.VariableLabels...), "bucket"),
+			opts.ConstLabels,
+		),
+		labels:     len(opts.VariableLabels),
+		cumulative: opts.Cumulative,
 	}
 
-	for id, max := range buckets {
-		dist.buckets[id] = &bucket{
-			gauge: prometheus.NewGaugeVec(prometheus.GaugeOpts{
-				Name:        opts.Name,
-				Help:        opts.Help,
-				ConstLabels: opts.ConstLabels,
-			}, []string{"bucket"}),
-			bucket: id,
-			max:    max,
-		}
+	var unbounded bool
+	for name, max := range buckets {
+		dist.buckets = append(dist.buckets, bucket{name: name, max: max})
+		unbounded = unbounded || math.IsInf(max, 1)
 	}
+	if !unbounded {
+		dist.buckets = append(dist.buckets, bucket{name: infBucket, max: math.Inf(1)})
+	}
+
+	sort.SliceStable(dist.buckets, func(i, j int) bool {
+		return dist.buckets[i].max < dist.buckets[j].max
+	})
 
-	// add infinity bucket to catch all observations above the highest bucket
-	dist.buckets[infBucket] = &bucket{
-		gauge: prometheus.NewGaugeVec(prometheus.GaugeOpts{
-			Name:        opts.Name,
-			Help:        opts.Help,
-			ConstLabels: opts.ConstLabels,
-		}, []string{"bucket"}),
-		bucket: infBucket,
-		max:    math.Inf(1),
+	dist.bounds = make([]float64, len(dist.buckets))
+	for i, b := range dist.buckets {
+		dist.bounds[i] = b.max
 	}
 
+	dist.current.Store(dist.NewSnapshot())
 	return dist
 }
 
 type distribution struct {
-	buckets map[string]*bucket
+	desc       *prometheus.Desc
+	labels     int
+	cumulative bool
+
+	// buckets are sorted by ascending upper bound, and bounds holds those upper bounds for searching
+	buckets []bucket
+	bounds  []float64
+
+	current atomic.Pointer[Snapshot]
 }
 
 type bucket struct {
-	gauge  *prometheus.GaugeVec
-	bucket string
-	max    float64
+	name string
+	max  float64
 }
 
-func (d *distribution) Reset() {
-	for _, d := range d.buckets {
-		d.gauge.WithLabelValues(d.bucket).Set(0)
-	}
+// Snapshot accumulates observations for a Distribution. It is not safe for concurrent use.
+type Snapshot struct {
+	bounds []float64
+	labels int
+	series map[string]*series
 }
 
-func (d *distribution) Describe(descs chan<- *prometheus.Desc) {
-	for _, d := range d.buckets {
-		d.gauge.Describe(descs)
-	}
+// series holds the bucket counts for a single combination of label values.
+type series struct {
+	labelValues []string
+	counts      []float64
 }
 
-func (d *distribution) Collect(metrics chan<- prometheus.Metric) {
-	for _, d := range d.buckets {
-		d.gauge.Collect(metrics)
+// labelSep separates label values when they are joined to form a series key; it cannot occur in valid UTF-8.
+const labelSep = "\xff"
+
+// Observe adds a single observation to the snapshot in the bucket with the lowest upper bound greater than
+// or equal to v. The number of label values must match the distribution's variable labels.
+// NaN observations are ignored.
+func (s *Snapshot) Observe(v float64, labelValues ...string) {
+	if math.IsNaN(v) {
+		return
+	}
+
+	if len(labelValues) != s.labels {
+		panic(fmt.Sprintf("metrics: expected %d label values, got %d", s.labels, len(labelValues)))
+	}
+
+	key := strings.Join(labelValues, labelSep)
+	ser, ok := s.series[key]
+	if !ok {
+		ser = &series{
+			labelValues: append([]string{}, labelValues...),
+			counts:      make([]float64, len(s.bounds)),
+		}
+		s.series[key] = ser
 	}
+
+	ser.counts[sort.SearchFloat64s(s.bounds, v)]++
 }
 
-func (d *distribution) Observe(v float64) {
-	var keys []string
-	for k := range d.buckets {
-		keys = append(keys, k)
+func (d *distribution) NewSnapshot() *Snapshot {
+	s := &Snapshot{
+		bounds: d.bounds,
+		labels: d.labels,
+		series: make(map[string]*series),
+	}
+
+	if d.labels == 0 {
+		// a distribution without labels always exports all of its buckets
+		s.series[""] = &series{counts: make([]float64, len(d.bounds))}
 	}
-	natsort.Sort(keys)
-
-	var prev float64 = 0
-	for _, bucket := range keys {
-		max := d.buckets[bucket].max
-		// find a bucket whose upper bound is less than or equal to v
-		if v > prev && v <= max {
-			d.buckets[bucket].gauge.WithLabelValues(bucket).Inc()
+
+	return s
+}
+
+func (d *distribution) Swap(s *Snapshot) {
+	d.current.Store(s)
+}
+
+func (d *distribution) Describe(descs chan<- *prometheus.Desc) {
+	descs <- d.desc
+}
+
+func (d *distribution) Collect(metrics chan<- prometheus.Metric) {
+	snapshot := d.current.Load()
+
+	for _, ser := range snapshot.series {
+		labelValues := append(append([]string{}, ser.labelValues...), "")
+
+		var total float64
+		for i, b := range d.buckets {
+			v := ser.counts[i]
+			if d.cumulative {
+				total += v
+				v = total
+			}
+
+			labelValues[len(labelValues)-1] = b.name
+			metrics <- prometheus.MustNewConstMetric(d.desc, prometheus.GaugeValue, v, labelValues...)
 		}
-		prev = max
 	}
 }
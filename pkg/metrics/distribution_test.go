@@ -0,0 +1,187 @@
+package metrics
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var testBuckets = map[string]float64{
+	"small":  1,
+	"medium": 5,
+	"large":  10,
+}
+
+// gather registers the collector with a pedantic registry, which checks the consistency of the collected metrics
+// against their descriptors, and returns the collected values by their label values joined with "/".
+func gather(t *testing.T, c prometheus.Collector) map[string]float64 {
+	t.Helper()
+
+	reg := prometheus.NewPedanticRegistry()
+	if err := reg.Register(c); err != nil {
+		t.Fatalf("registering collector: %v", err)
+	}
+
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("gathering collector: %v", err)
+	}
+	if len(families) > 1 {
+		t.Fatalf("expected at most 1 metric family, got %d", len(families))
+	}
+
+	values := make(map[string]float64)
+	if len(families) == 0 {
+		return values
+	}
+
+	for _, m := range families[0].GetMetric() {
+		var labelValues []string
+		for _, pair := range m.GetLabel() {
+			labelValues = append(labelValues, pair.GetValue())
+		}
+
+		key := strings.Join(labelValues, "/")
+		if _, ok := values[key]; ok {
+			t.Fatalf("duplicate series %q", key)
+		}
+		values[key] = m.GetGauge().GetValue()
+	}
+	return values
+}
+
+func assertValues(t *testing.T, got, want map[string]float64) {
+	t.Helper()
+
+	if len(got) != len(want) {
+		t.Errorf("expected %d series, got %d: %v", len(want), len(got), got)
+	}
+	for key, v := range want {
+		if got[key] != v {
+			t.Errorf("series %q: expected %v, got %v", key, v, got[key])
+		}
+	}
+}
+
+func TestDistributionObserveZero(t *testing.T) {
+	dist := NewDistribution(DistributionOpts{Name: "test", Help: "test"}, testBuckets)
+
+	s := dist.NewSnapshot()
+	s.Observe(0)
+	dist.Swap(s)
+
+	assertValues(t, gather(t, dist), map[string]float64{
+		"small":  1,
+		"medium": 0,
+		"large":  0,
+		"+Inf":   0,
+	})
+}
+
+func TestDistributionBuckets(t *testing.T) {
+	dist := NewDistribution(DistributionOpts{Name: "test", Help: "test"}, testBuckets)
+
+	s := dist.NewSnapshot()
+	for _, v := range []float64{1, 2, 5, 7, 11, 100, math.NaN()} {
+		s.Observe(v)
+	}
+	dist.Swap(s)
+
+	assertValues(t, gather(t, dist), map[string]float64{
+		"small":  1,
+		"medium": 2,
+		"large":  1,
+		"+Inf":   2,
+	})
+}
+
+func TestDistributionCumulative(t *testing.T) {
+	dist := NewDistribution(DistributionOpts{Name: "test", Help: "test", Cumulative: true}, testBuckets)
+
+	s := dist.NewSnapshot()
+	for _, v := range []float64{1, 2, 5, 7, 11, 100} {
+		s.Observe(v)
+	}
+	dist.Swap(s)
+
+	assertValues(t, gather(t, dist), map[string]float64{
+		"small":  1,
+		"medium": 3,
+		"large":  4,
+		"+Inf":   6,
+	})
+}
+
+func TestDistributionUnboundedBucket(t *testing.T) {
+	dist := NewDistribution(DistributionOpts{Name: "test", Help: "test"}, map[string]float64{
+		"small": 1,
+		"rest":  math.Inf(1),
+	})
+
+	s := dist.NewSnapshot()
+	s.Observe(1)
+	s.Observe(100)
+	dist.Swap(s)
+
+	// no "+Inf" bucket is added when one of the buckets is already unbounded
+	assertValues(t, gather(t, dist), map[string]float64{
+		"small": 1,
+		"rest":  1,
+	})
+}
+
+func TestDistributionLabels(t *testing.T) {
+	dist := NewDistribution(DistributionOpts{
+		Name:           "test",
+		Help:           "test",
+		ConstLabels:    prometheus.Labels{"repo": "rhythm"},
+		VariableLabels: []string{"kind"},
+	}, testBuckets)
+
+	// nothing is exported for a distribution with variable labels until something is observed
+	assertValues(t, gather(t, dist), map[string]float64{})
+
+	s := dist.NewSnapshot()
+	s.Observe(3, "issue")
+	s.Observe(30, "pull_request")
+	dist.Swap(s)
+
+	assertValues(t, gather(t, dist), map[string]float64{
+		"small/issue/rhythm":         0,
+		"medium/issue/rhythm":        1,
+		"large/issue/rhythm":         0,
+		"+Inf/issue/rhythm":          0,
+		"small/pull_request/rhythm":  0,
+		"medium/pull_request/rhythm": 0,
+		"large/pull_request/rhythm":  0,
+		"+Inf/pull_request/rhythm":   1,
+	})
+}
+
+func TestDistributionSwap(t *testing.T) {
+	dist := NewDistribution(DistributionOpts{Name: "test", Help: "test"}, testBuckets)
+
+	s := dist.NewSnapshot()
+	s.Observe(3)
+	dist.Swap(s)
+
+	// observations into a new snapshot are not visible until it is swapped in
+	next := dist.NewSnapshot()
+	next.Observe(7)
+	assertValues(t, gather(t, dist), map[string]float64{
+		"small":  0,
+		"medium": 1,
+		"large":  0,
+		"+Inf":   0,
+	})
+
+	dist.Swap(next)
+	assertValues(t, gather(t, dist), map[string]float64{
+		"small":  0,
+		"medium": 0,
+		"large":  1,
+		"+Inf":   0,
+	})
+}
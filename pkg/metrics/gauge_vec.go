@@ -0,0 +1,107 @@
+package metrics
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// GaugeVec is a prometheus.Collector of gauges partitioned by labels, like prometheus.GaugeVec, except that all of
+// its values are replaced at once.
+//
+// Values are set in a GaugeSnapshot, which atomically replaces the current values once complete. Series which are
+// not set in the new snapshot are removed rather than reported as zero, and a scrape never sees a partially-updated
+// set of series.
+type GaugeVec interface {
+	prometheus.Collector
+
+	// NewSnapshot returns an empty snapshot, to be published with Swap once all values have been set.
+	NewSnapshot() *GaugeSnapshot
+	// Swap replaces the current values of the gauges with the given snapshot.
+	Swap(*GaugeSnapshot)
+}
+
+// NewGaugeVec creates a GaugeVec partitioned by the given label names.
+func NewGaugeVec(opts prometheus.GaugeOpts, labelNames []string) GaugeVec {
+	vec := &gaugeVec{
+		desc: prometheus.NewDesc(
+			prometheus.BuildFQName(opts.Namespace, opts.Subsystem, opts.Name),
+			opts.Help,
+			labelNames,
+			opts.ConstLabels,
+		),
+		labels: len(labelNames),
+	}
+
+	vec.current.Store(vec.NewSnapshot())
+	return vec
+}
+
+type gaugeVec struct {
+	desc   *prometheus.Desc
+	labels int
+
+	current atomic.Pointer[GaugeSnapshot]
+}
+
+// GaugeSnapshot accumulates the values of a GaugeVec. It is not safe for concurrent use.
+type GaugeSnapshot struct {
+	labels int
+	series map[string]*gauge
+}
+
+// gauge holds the value for a single combination of label values.
+type gauge struct {
+	labelValues []string
+	value       float64
+}
+
+// Set sets the value of the series with the given label values. The number of label values must match the
+// GaugeVec's label names.
+func (s *GaugeSnapshot) Set(v float64, labelValues ...string) {
+	s.get(labelValues).value = v
+}
+
+// Add adds to the value of the series with the given label values, which starts at zero.
+// The number of label values must match the GaugeVec's label names.
+func (s *GaugeSnapshot) Add(v float64, labelValues ...string) {
+	s.get(labelValues).value += v
+}
+
+func (s *GaugeSnapshot) get(labelValues []string) *gauge {
+	if len(labelValues) != s.labels {
+		panic(fmt.Sprintf("metrics: expected %d label values, got %d", s.labels, len(labelValues)))
+	}
+
+	key := strings.Join(labelValues, labelSep)
+	g, ok := s.series[key]
+	if !ok {
+		g = &gauge{labelValues: append([]string{}, labelValues...)}
+		s.series[key] = g
+	}
+
+	return g
+}
+
+func (v *gaugeVec) NewSnapshot() *GaugeSnapshot {
+	return &GaugeSnapshot{
+		labels: v.labels,
+		series: make(map[string]*gauge),
+	}
+}
+
+func (v *gaugeVec) Swap(s *GaugeSnapshot) {
+	v.current.Store(s)
+}
+
+func (v *gaugeVec) Describe(descs chan<- *prometheus.Desc) {
+	descs <- v.desc
+}
+
+func (v *gaugeVec) Collect(metrics chan<- prometheus.Metric) {
+	for _, g := range v.current.Load().series {
+		metrics <- prometheus.MustNewConstMetric(v.desc, prometheus.GaugeValue, g.value, g.labelValues...)
+	}
+}
@@ -0,0 +1,38 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestGaugeVecSwap(t *testing.T) {
+	vec := NewGaugeVec(prometheus.GaugeOpts{
+		Name:        "test",
+		Help:        "test",
+		ConstLabels: prometheus.Labels{"repo": "rhythm"},
+	}, []string{"label"})
+
+	// nothing is exported until a snapshot is swapped in
+	assertValues(t, gather(t, vec), map[string]float64{})
+
+	s := vec.NewSnapshot()
+	s.Set(2, "bug")
+	s.Add(1, "feature")
+	s.Add(1, "feature")
+	vec.Swap(s)
+
+	// values set in a new snapshot are not visible until it is swapped in
+	next := vec.NewSnapshot()
+	next.Set(5, "bug")
+	assertValues(t, gather(t, vec), map[string]float64{
+		"bug/rhythm":     2,
+		"feature/rhythm": 2,
+	})
+
+	// series which are not set in the new snapshot are removed
+	vec.Swap(next)
+	assertValues(t, gather(t, vec), map[string]float64{
+		"bug/rhythm": 5,
+	})
+}
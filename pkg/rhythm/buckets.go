@@ -0,0 +1,17 @@
+package rhythm
+
+import "gopkg.in/yaml.v3"
+
+// Buckets maps the names of distribution buckets to their upper bounds.
+type Buckets map[string]float64
+
+// UnmarshalYAML replaces any existing buckets, e.g. the defaults, rather than adding to them.
+func (b *Buckets) UnmarshalYAML(value *yaml.Node) error {
+	var buckets map[string]float64
+	if err := value.Decode(&buckets); err != nil {
+		return err
+	}
+
+	*b = buckets
+	return nil
+}
@@ -1,10 +1,483 @@
 package rhythm
 
-import "time"
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+)
 
 type Config struct {
-	Owner           string
-	Repo            string
-	TimeoutDuration time.Duration
-	TickInterval    time.Duration
+	// Repositories lists the repositories to monitor; every beat runs against each of them.
+	Repositories []Repository `yaml:"repositories"`
+	// Discovery finds further repositories to monitor by listing those belonging to organizations or users.
+	Discovery DiscoveryConfig `yaml:"discovery"`
+
+	// Token is the GitHub token used to authenticate API requests.
+	// It is typically provided via the GITHUB_TOKEN environment variable rather than the config file.
+	Token string `yaml:"token"`
+
+	ListenAddress   string        `yaml:"listen_address"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+	TimeoutDuration time.Duration `yaml:"timeout"`
+	// TickInterval is how often beats tick, unless overridden per beat.
+	TickInterval time.Duration   `yaml:"tick_interval"`
+	Scheduler    SchedulerConfig `yaml:"scheduler"`
+
+	Sync      SyncConfig      `yaml:"sync"`
+	Store     StoreConfig     `yaml:"store"`
+	RateLimit RateLimitConfig `yaml:"rate_limit"`
+	Retry     RetryConfig     `yaml:"retry"`
+
+	// Beats lists the names of the beats to run; all beats are run if empty.
+	Beats                []string                   `yaml:"beats"`
+	ClosedIssueLifecycle ClosedIssueLifecycleConfig `yaml:"closed_issue_lifecycle"`
+	FirstResponse        FirstResponseConfig        `yaml:"first_response"`
+	ReviewTurnaround     ReviewTurnaroundConfig     `yaml:"review_turnaround"`
+	ReviewRequests       ReviewRequestsConfig       `yaml:"review_requests"`
+	Stale                StaleConfig                `yaml:"stale"`
+	Throughput           ThroughputConfig           `yaml:"throughput"`
+	Contributors         ContributorsConfig         `yaml:"contributors"`
+	Releases             ReleasesConfig             `yaml:"releases"`
+	Commits              CommitsConfig              `yaml:"commits"`
+	Checks               ChecksConfig               `yaml:"checks"`
+	PullRequestSize      PullRequestSizeConfig      `yaml:"pull_request_size"`
+	Milestones           MilestonesConfig           `yaml:"milestones"`
+	Assignees            AssigneesConfig            `yaml:"assignees"`
+
+	// Labels selects the labels by which issue and pull request counts and ages are split, in addition to their
+	// totals. Each selector is an exact label name, a prefix (e.g. "area/*", which also matches "area/a/b"), a glob
+	// (e.g. "type/?ug") or a regular expression (e.g. "/^priority/.+/"); see Pattern.
+	// Issues and pull requests with none of the selected labels are counted as "unlabelled".
+	Labels []Pattern `yaml:"labels"`
+
+	// Bots lists the logins of accounts which should be treated as bots, in addition to GitHub Apps.
+	Bots []string `yaml:"bots"`
+	// CumulativeDistributions causes each bucket of a distribution to count all observations up to its upper bound,
+	// like a histogram, rather than only those above the previous bucket's upper bound.
+	CumulativeDistributions bool `yaml:"cumulative_distributions"`
+}
+
+type ClosedIssueLifecycleConfig struct {
+	// Windows restricts the lifecycle distribution to issues closed within each look-back window.
+	Windows []Window `yaml:"windows"`
+}
+
+type FirstResponseConfig struct {
+	// Window restricts the time to first response to issues and pull requests created within it, since finding each
+	// one's first response requires fetching its timeline. Open issues and pull requests awaiting a response are
+	// counted regardless of when they were created.
+	Window Window `yaml:"window"`
+}
+
+type ReviewTurnaroundConfig struct {
+	// Window restricts review turnaround metrics to pull requests created within it,
+	// since finding each one's reviews requires fetching its timeline.
+	Window Window `yaml:"window"`
+}
+
+type ReviewRequestsConfig struct {
+	// TopN limits the reviewers labelled individually to those with the most outstanding requests;
+	// the rest are aggregated as "other". Zero disables the limit.
+	TopN int `yaml:"top_n"`
+}
+
+type StaleConfig struct {
+	// Thresholds are the periods of inactivity after which open issues and pull requests are counted as stale.
+	Thresholds []Window `yaml:"thresholds"`
+	// Labels selects the labels which mark issues and pull requests as stale, e.g. "lifecycle/stale".
+	// If set, stale counts are split by whether any such label is applied.
+	Labels []Pattern `yaml:"labels"`
+}
+
+type ThroughputConfig struct {
+	// Windows are the look-back windows within which opened, closed and merged issues and pull requests are counted.
+	Windows []Window `yaml:"windows"`
+}
+
+type ContributorsConfig struct {
+	// Windows are the look-back windows within which distinct contributors are counted.
+	Windows []Window `yaml:"windows"`
+}
+
+type ReleasesConfig struct {
+	// Window restricts release counts and intervals to releases published within it.
+	Window Window `yaml:"window"`
+	// Tags causes tags without a release to be counted as stable releases.
+	Tags bool `yaml:"tags"`
+}
+
+type CommitsConfig struct {
+	// Windows are the look-back windows within which commits to the default branch are counted.
+	// The history of the default branch is fetched as far back as the longest window.
+	Windows []Window `yaml:"windows"`
+}
+
+type ChecksConfig struct {
+	// Commits is the number of latest commits to the default branch whose checks are measured, alongside those of
+	// open pull requests. Zero measures only open pull requests.
+	Commits int `yaml:"commits"`
+	// TopN limits the checks labelled individually to those which ran most often;
+	// the rest are aggregated as "other". Zero disables the limit.
+	TopN int `yaml:"top_n"`
+	// Allowlist lists the names of the checks to label individually, instead of the top N.
+	Allowlist []string `yaml:"allowlist"`
+}
+
+// PullRequestSizeConfig names the sizes into which pull requests are bucketed, like the labels applied by
+// size labellers, by their upper bounds. Larger pull requests fall into a "+Inf" bucket.
+type PullRequestSizeConfig struct {
+	// Window restricts merged pull requests to those merged within it; all open pull requests are measured.
+	Window Window `yaml:"window"`
+	// Lines buckets pull requests by lines added, deleted, and changed in total.
+	Lines Buckets `yaml:"lines"`
+	// Files buckets pull requests by the number of files changed.
+	Files Buckets `yaml:"files"`
+	// Commits buckets pull requests by their number of commits.
+	Commits Buckets `yaml:"commits"`
+}
+
+type MilestonesConfig struct {
+	// Projects lists the numbers of projects linked to the repository whose items are counted by status.
+	Projects []int `yaml:"projects"`
+	// StatusField is the name of the single select field holding the status of project items.
+	StatusField string `yaml:"status_field"`
+}
+
+type AssigneesConfig struct {
+	// TopN limits the assignees labelled individually to those with the most open assignments;
+	// the rest are aggregated as "other". Zero disables the limit.
+	TopN int `yaml:"top_n"`
+	// Allowlist lists the logins of the assignees to label individually, instead of the top N.
+	Allowlist []string `yaml:"allowlist"`
+}
+
+type SchedulerConfig struct {
+	// Intervals overrides the tick interval of individual beats, by name.
+	Intervals map[string]time.Duration `yaml:"intervals"`
+	// Jitter randomly spreads ticks by up to this fraction of each beat's interval, so that beats don't all tick at once.
+	Jitter float64 `yaml:"jitter"`
+	// MaxConcurrentBeats limits the number of beats which can tick at once, across all repositories.
+	MaxConcurrentBeats int `yaml:"max_concurrent_beats"`
+}
+
+// SyncConfig controls how the issues and pull requests shared by beats are kept up to date.
+type SyncConfig struct {
+	// MinInterval is the shortest time between syncs; beats which tick more often reuse the previous sync.
+	MinInterval time.Duration `yaml:"min_interval"`
+}
+
+// StoreConfig controls where fetched issues, pull requests and sync progress are persisted,
+// so that a restart doesn't require everything to be fetched again.
+type StoreConfig struct {
+	// Path is the file in which state is stored; nothing is persisted if empty.
+	Path string `yaml:"path"`
+	// Wipe discards all stored state on startup, so that it is rebuilt from scratch.
+	Wipe bool `yaml:"-"`
+}
+
+// RateLimitConfig controls how the GraphQL API rate limit, which is shared by all beats, is spent.
+type RateLimitConfig struct {
+	// Reserve is the number of points to leave unspent in each rate limit window, e.g. for other users of the token.
+	Reserve int `yaml:"reserve"`
+	// MaxWait is the longest a query will wait for the rate limit to reset; queries which would need to wait longer fail.
+	MaxWait time.Duration `yaml:"max_wait"`
+}
+
+// RetryConfig controls how failed queries are retried.
+// Retries are delayed by an exponential backoff with jitter, or by as long as the API asks for.
+type RetryConfig struct {
+	// MaxAttempts is the number of times a query is attempted before giving up; 1 disables retries.
+	MaxAttempts int           `yaml:"max_attempts"`
+	MinBackoff  time.Duration `yaml:"min_backoff"`
+	// MaxBackoff also bounds the delay the API can ask for; queries which would need to wait longer fail.
+	// Waiting for a rate limit to reset is bounded by RateLimitConfig.MaxWait instead.
+	MaxBackoff time.Duration `yaml:"max_backoff"`
+}
+
+type DiscoveryConfig struct {
+	// Interval controls how often repositories are rediscovered.
+	Interval time.Duration `yaml:"interval"`
+	Owners   []OwnerConfig `yaml:"owners"`
+}
+
+// OwnerConfig selects the repositories of an organization or user to monitor.
+// By default all public and private repositories are selected, excluding archived repositories and forks.
+type OwnerConfig struct {
+	// Owner is the login of the organization or user.
+	Owner string `yaml:"owner"`
+
+	Archived bool `yaml:"archived"`
+	Forks    bool `yaml:"forks"`
+	// Visibility restricts repositories to those with any of the given visibilities (public, private, internal).
+	Visibility []string `yaml:"visibility"`
+	// Topics restricts repositories to those with any of the given topics.
+	Topics []string `yaml:"topics"`
+	// Include restricts repositories to those whose names match any of the given patterns.
+	Include []Pattern `yaml:"include"`
+	// Exclude removes repositories whose names match any of the given patterns.
+	Exclude []Pattern `yaml:"exclude"`
+}
+
+// Default returns a Config with all defaults applied.
+func Default() *Config {
+	return &Config{
+		ListenAddress:   ":9123",
+		ShutdownTimeout: 30 * time.Second,
+		TimeoutDuration: 10 * time.Second,
+		TickInterval:    time.Minute,
+		ClosedIssueLifecycle: ClosedIssueLifecycleConfig{
+			Windows: []Window{Window(30 * 24 * time.Hour), Window(90 * 24 * time.Hour), AllTime},
+		},
+		FirstResponse: FirstResponseConfig{
+			Window: Window(90 * 24 * time.Hour),
+		},
+		ReviewTurnaround: ReviewTurnaroundConfig{
+			Window: Window(90 * 24 * time.Hour),
+		},
+		ReviewRequests: ReviewRequestsConfig{
+			TopN: 20,
+		},
+		Stale: StaleConfig{
+			Thresholds: []Window{Window(30 * 24 * time.Hour), Window(90 * 24 * time.Hour), Window(180 * 24 * time.Hour)},
+		},
+		Throughput: ThroughputConfig{
+			Windows: []Window{Window(24 * time.Hour), Window(7 * 24 * time.Hour), Window(30 * 24 * time.Hour)},
+		},
+		Contributors: ContributorsConfig{
+			Windows: []Window{Window(7 * 24 * time.Hour), Window(30 * 24 * time.Hour), Window(90 * 24 * time.Hour)},
+		},
+		Releases: ReleasesConfig{
+			Window: Window(365 * 24 * time.Hour),
+		},
+		Commits: CommitsConfig{
+			Windows: []Window{Window(7 * 24 * time.Hour), Window(30 * 24 * time.Hour), Window(90 * 24 * time.Hour)},
+		},
+		Checks: ChecksConfig{
+			Commits: 20,
+			TopN:    20,
+		},
+		PullRequestSize: PullRequestSizeConfig{
+			Window:  Window(30 * 24 * time.Hour),
+			Lines:   Buckets{"XS": 9, "S": 29, "M": 99, "L": 499, "XL": 999},
+			Files:   Buckets{"XS": 1, "S": 5, "M": 10, "L": 30, "XL": 100},
+			Commits: Buckets{"XS": 1, "S": 3, "M": 5, "L": 10, "XL": 20},
+		},
+		Milestones: MilestonesConfig{
+			StatusField: "Status",
+		},
+		Assignees: AssigneesConfig{
+			TopN: 20,
+		},
+		Scheduler: SchedulerConfig{
+			Jitter:             0.1,
+			MaxConcurrentBeats: 4,
+		},
+		Sync: SyncConfig{
+			MinInterval: 30 * time.Second,
+		},
+		RateLimit: RateLimitConfig{
+			Reserve: 100,
+			MaxWait: time.Hour,
+		},
+		Retry: RetryConfig{
+			MaxAttempts: 5,
+			MinBackoff:  time.Second,
+			MaxBackoff:  time.Minute,
+		},
+		Discovery: DiscoveryConfig{
+			Interval: time.Hour,
+		},
+	}
+}
+
+// RegisterFlags binds command-line flags to the fields of the Config.
+// The current field values are used as the flags' defaults.
+func (c *Config) RegisterFlags(fs *flag.FlagSet) {
+	fs.Var((*repositoryList)(&c.Repositories), "repositories", "Comma-separated list of repositories to monitor, as owner/repo.")
+	fs.DurationVar(&c.Discovery.Interval, "discovery.interval", c.Discovery.Interval, "Interval between repository discoveries.")
+	fs.StringVar(&c.ListenAddress, "listen-address", c.ListenAddress, "Address on which to expose /metrics.")
+	fs.DurationVar(&c.ShutdownTimeout, "shutdown-timeout", c.ShutdownTimeout, "Maximum time to wait for beats to stop and the HTTP server to shut down.")
+	fs.DurationVar(&c.TimeoutDuration, "timeout", c.TimeoutDuration, "Timeout for each GitHub API request.")
+	fs.DurationVar(&c.TickInterval, "tick-interval", c.TickInterval, "Interval between beat ticks.")
+	fs.Float64Var(&c.Scheduler.Jitter, "scheduler.jitter", c.Scheduler.Jitter, "Fraction of each beat's interval by which its ticks are randomly spread.")
+	fs.IntVar(&c.Scheduler.MaxConcurrentBeats, "scheduler.max-concurrent-beats", c.Scheduler.MaxConcurrentBeats, "Maximum number of beats which can tick at once.")
+	fs.DurationVar(&c.Sync.MinInterval, "sync.min-interval", c.Sync.MinInterval, "Shortest time between syncs of issues and pull requests.")
+	fs.StringVar(&c.Store.Path, "store.path", c.Store.Path, "File in which to persist state between restarts (default: none).")
+	fs.BoolVar(&c.Store.Wipe, "store.wipe", c.Store.Wipe, "Wipe all persisted state on startup, forcing a full resync.")
+	fs.IntVar(&c.RateLimit.Reserve, "rate-limit.reserve", c.RateLimit.Reserve, "Number of rate limit points to leave unspent in each window.")
+	fs.DurationVar(&c.RateLimit.MaxWait, "rate-limit.max-wait", c.RateLimit.MaxWait, "Longest a query will wait for the rate limit to reset.")
+	fs.IntVar(&c.Retry.MaxAttempts, "retry.max-attempts", c.Retry.MaxAttempts, "Number of times a query is attempted before giving up.")
+	fs.DurationVar(&c.Retry.MinBackoff, "retry.min-backoff", c.Retry.MinBackoff, "Initial delay between attempts of a failed query.")
+	fs.DurationVar(&c.Retry.MaxBackoff, "retry.max-backoff", c.Retry.MaxBackoff, "Maximum delay between attempts of a failed query.")
+	fs.Var((*stringList)(&c.Beats), "beats", "Comma-separated list of beats to run (default: all).")
+	fs.BoolVar(&c.CumulativeDistributions, "cumulative-distributions", c.CumulativeDistributions, "Count all observations up to each distribution bucket's upper bound.")
+}
+
+// IsBot reports whether the given login belongs to a bot: either a GitHub App, as reported by the API,
+// or a user account listed in the config.
+func (c *Config) IsBot(login string, app bool) bool {
+	if app || strings.HasSuffix(login, "[bot]") {
+		return true
+	}
+
+	for _, bot := range c.Bots {
+		if strings.EqualFold(bot, login) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Validate checks the Config for errors, returning all problems found. Beats are selected by name, so the names of
+// all available beats must be given.
+func (c *Config) Validate(beatNames []string) error {
+	var errs []error
+
+	available := make(map[string]struct{}, len(beatNames))
+	for _, name := range beatNames {
+		available[name] = struct{}{}
+	}
+	unknownBeat := func(name string) error {
+		return fmt.Errorf("unknown beat %q (available: %s)", name, strings.Join(beatNames, ", "))
+	}
+
+	if len(c.Repositories) == 0 && len(c.Discovery.Owners) == 0 {
+		errs = append(errs, errors.New("at least one repository or discovery owner must be set"))
+	}
+	repos := make(map[Repository]struct{}, len(c.Repositories))
+	for _, repo := range c.Repositories {
+		if _, ok := repos[repo]; ok {
+			errs = append(errs, fmt.Errorf("repository %q is listed more than once", repo))
+		}
+		repos[repo] = struct{}{}
+	}
+	if c.Retry.MaxAttempts < 1 {
+		errs = append(errs, fmt.Errorf("retry.max_attempts must be at least 1, got %d", c.Retry.MaxAttempts))
+	}
+	if c.Retry.MinBackoff <= 0 || c.Retry.MaxBackoff < c.Retry.MinBackoff {
+		errs = append(errs, fmt.Errorf("retry backoff must satisfy 0 < min_backoff (%s) <= max_backoff (%s)", c.Retry.MinBackoff, c.Retry.MaxBackoff))
+	}
+	errs = append(errs, c.Discovery.validate())
+	if c.Token == "" {
+		errs = append(errs, errors.New("token must be set (hint: set the GITHUB_TOKEN environment variable)"))
+	}
+	if c.ListenAddress == "" {
+		errs = append(errs, errors.New("listen_address must be set"))
+	}
+	if c.ShutdownTimeout <= 0 {
+		errs = append(errs, fmt.Errorf("shutdown_timeout must be positive, got %s", c.ShutdownTimeout))
+	}
+	if c.TimeoutDuration <= 0 {
+		errs = append(errs, fmt.Errorf("timeout must be positive, got %s", c.TimeoutDuration))
+	}
+	if c.TickInterval <= 0 {
+		errs = append(errs, fmt.Errorf("tick_interval must be positive, got %s", c.TickInterval))
+	}
+	for name, interval := range c.Scheduler.Intervals {
+		if _, ok := available[name]; !ok {
+			errs = append(errs, fmt.Errorf("scheduler.intervals: %w", unknownBeat(name)))
+		}
+		if interval <= 0 {
+			errs = append(errs, fmt.Errorf("scheduler.intervals.%s must be positive, got %s", name, interval))
+		}
+	}
+	if c.Scheduler.Jitter < 0 || c.Scheduler.Jitter > 1 {
+		errs = append(errs, fmt.Errorf("scheduler.jitter must be between 0 and 1, got %v", c.Scheduler.Jitter))
+	}
+	if c.Scheduler.MaxConcurrentBeats < 1 {
+		errs = append(errs, fmt.Errorf("scheduler.max_concurrent_beats must be at least 1, got %d", c.Scheduler.MaxConcurrentBeats))
+	}
+	if c.Sync.MinInterval < 0 {
+		errs = append(errs, fmt.Errorf("sync.min_interval must not be negative, got %s", c.Sync.MinInterval))
+	}
+	if len(c.ClosedIssueLifecycle.Windows) == 0 {
+		errs = append(errs, errors.New("closed_issue_lifecycle.windows must not be empty"))
+	}
+	if len(c.Throughput.Windows) == 0 {
+		errs = append(errs, errors.New("throughput.windows must not be empty"))
+	}
+	if len(c.Contributors.Windows) == 0 {
+		errs = append(errs, errors.New("contributors.windows must not be empty"))
+	}
+	if len(c.Commits.Windows) == 0 {
+		errs = append(errs, errors.New("commits.windows must not be empty"))
+	}
+	if c.Checks.Commits < 0 || c.Checks.Commits > 100 {
+		errs = append(errs, fmt.Errorf("checks.commits must be between 0 and 100, got %d", c.Checks.Commits))
+	}
+	if c.Checks.TopN < 0 {
+		errs = append(errs, fmt.Errorf("checks.top_n must not be negative, got %d", c.Checks.TopN))
+	}
+	for measure, buckets := range map[string]Buckets{
+		"lines":   c.PullRequestSize.Lines,
+		"files":   c.PullRequestSize.Files,
+		"commits": c.PullRequestSize.Commits,
+	} {
+		if len(buckets) == 0 {
+			errs = append(errs, fmt.Errorf("pull_request_size.%s must not be empty", measure))
+		}
+	}
+	if len(c.Milestones.Projects) > 0 && c.Milestones.StatusField == "" {
+		errs = append(errs, errors.New("milestones.status_field must be set if milestones.projects is set"))
+	}
+	if c.ReviewRequests.TopN < 0 {
+		errs = append(errs, fmt.Errorf("review_requests.top_n must not be negative, got %d", c.ReviewRequests.TopN))
+	}
+	for _, threshold := range c.Stale.Thresholds {
+		if threshold == AllTime {
+			errs = append(errs, errors.New("stale.thresholds must be finite periods, e.g. 30d"))
+		}
+	}
+	if c.Assignees.TopN < 0 {
+		errs = append(errs, fmt.Errorf("assignees.top_n must not be negative, got %d", c.Assignees.TopN))
+	}
+	if c.Store.Wipe && c.Store.Path == "" {
+		errs = append(errs, errors.New("store.wipe requires store.path to be set"))
+	}
+	if c.RateLimit.Reserve < 0 {
+		errs = append(errs, fmt.Errorf("rate_limit.reserve must not be negative, got %d", c.RateLimit.Reserve))
+	}
+	if c.RateLimit.MaxWait < 0 {
+		errs = append(errs, fmt.Errorf("rate_limit.max_wait must not be negative, got %s", c.RateLimit.MaxWait))
+	}
+
+	seen := make(map[string]struct{}, len(c.Beats))
+	for _, name := range c.Beats {
+		if _, ok := available[name]; !ok {
+			errs = append(errs, unknownBeat(name))
+		}
+		if _, ok := seen[name]; ok {
+			errs = append(errs, fmt.Errorf("beat %q is listed more than once", name))
+		}
+		seen[name] = struct{}{}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (c *DiscoveryConfig) validate() error {
+	var errs []error
+
+	if len(c.Owners) > 0 && c.Interval <= 0 {
+		errs = append(errs, fmt.Errorf("discovery.interval must be positive, got %s", c.Interval))
+	}
+
+	for i, owner := range c.Owners {
+		if owner.Owner == "" {
+			errs = append(errs, fmt.Errorf("discovery.owners[%d]: owner must be set", i))
+		}
+
+		for _, v := range owner.Visibility {
+			switch strings.ToUpper(v) {
+			case "PUBLIC", "PRIVATE", "INTERNAL":
+			default:
+				errs = append(errs, fmt.Errorf("discovery.owners[%d]: invalid visibility %q (expected public, private or internal)", i, v))
+			}
+		}
+	}
+
+	return errors.Join(errs...)
 }
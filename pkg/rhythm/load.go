@@ -0,0 +1,128 @@
+package rhythm
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const envPrefix = "REPO_RHYTHM_"
+
+// Load builds a Config from defaults, an optional YAML config file, environment variables and command-line flags,
+// in increasing order of precedence. The resulting Config is validated before it is returned, against the given
+// names of the available beats.
+//
+// Every flag can also be set by an environment variable named after it, e.g. -listen-address can be set
+// via REPO_RHYTHM_LISTEN_ADDRESS. The config file is given by -config.file (or REPO_RHYTHM_CONFIG_FILE).
+func Load(name string, args []string, beatNames []string) (*Config, error) {
+	path, err := configFile(name, args)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := Default()
+	if path != "" {
+		if err := cfg.loadFile(path); err != nil {
+			return nil, err
+		}
+	}
+
+	if token, ok := os.LookupEnv("GITHUB_TOKEN"); ok {
+		cfg.Token = token
+	}
+
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.String("config.file", path, "Path to a YAML config file.")
+	cfg.RegisterFlags(fs)
+
+	// environment variables are applied as though they were flags, so that flags given on the command-line
+	// are applied afterwards and take precedence
+	var envErrs []error
+	fs.VisitAll(func(f *flag.Flag) {
+		key := envName(f.Name)
+		if val, ok := os.LookupEnv(key); ok {
+			if err := fs.Set(f.Name, val); err != nil {
+				envErrs = append(envErrs, fmt.Errorf("invalid value %q for %s: %w", val, key, err))
+			}
+		}
+	})
+	if err := errors.Join(envErrs...); err != nil {
+		return nil, err
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Validate(beatNames); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+
+	return cfg, nil
+}
+
+// configFile determines the config file path before any other flags are parsed,
+// since values from the file need to be applied beneath those given on the command-line.
+func configFile(name string, args []string) (string, error) {
+	var path string
+
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.StringVar(&path, "config.file", os.Getenv(envName("config.file")), "")
+	Default().RegisterFlags(fs)
+
+	err := fs.Parse(args)
+	if err != nil && !errors.Is(err, flag.ErrHelp) {
+		// the error will be reported properly when the flags are parsed for real
+		return "", nil
+	}
+
+	return path, nil
+}
+
+func (c *Config) loadFile(path string) error {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	dec := yaml.NewDecoder(bytes.NewReader(buf))
+	dec.KnownFields(true)
+
+	if err := dec.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("failed to parse config file %q: %w", path, err)
+	}
+
+	return nil
+}
+
+func envName(flag string) string {
+	return envPrefix + strings.ToUpper(strings.NewReplacer("-", "_", ".", "_").Replace(flag))
+}
+
+// stringList is a flag.Value holding a comma-separated list of strings.
+// Setting it replaces any previous value, so that flags override lists from the config file.
+type stringList []string
+
+func (s *stringList) String() string {
+	if s == nil {
+		return ""
+	}
+	return strings.Join(*s, ",")
+}
+
+func (s *stringList) Set(val string) error {
+	*s = nil
+	for _, v := range strings.Split(val, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			*s = append(*s, v)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package rhythm
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// Pattern matches names, e.g. of repositories or labels.
+// A pattern enclosed in slashes (e.g. "/^loki-.*$/") is a regular expression; anything else is a glob (e.g. "loki-*"),
+// which matches only itself if it contains no wildcards.
+//
+// A glob whose only wildcard is a trailing "*" is a prefix, which matches any name starting with the rest of the
+// pattern, including any "/" (e.g. "area/*" matches "area/a/b"). Otherwise, as in path.Match, "*" and "?" don't match "/".
+type Pattern struct {
+	raw    string
+	glob   string
+	prefix *string
+	re     *regexp.Regexp
+}
+
+func (p Pattern) String() string {
+	return p.raw
+}
+
+// Match reports whether the given name matches the pattern.
+func (p Pattern) Match(name string) bool {
+	if p.re != nil {
+		return p.re.MatchString(name)
+	}
+	if p.prefix != nil {
+		return strings.HasPrefix(name, *p.prefix)
+	}
+
+	ok, _ := path.Match(p.glob, name)
+	return ok
+}
+
+func (p Pattern) MarshalText() ([]byte, error) {
+	return []byte(p.raw), nil
+}
+
+func (p *Pattern) UnmarshalText(text []byte) error {
+	raw := string(text)
+	if raw == "" {
+		return fmt.Errorf("empty pattern")
+	}
+
+	if len(raw) > 1 && strings.HasPrefix(raw, "/") && strings.HasSuffix(raw, "/") {
+		re, err := regexp.Compile(raw[1 : len(raw)-1])
+		if err != nil {
+			return fmt.Errorf("invalid regular expression %q: %w", raw, err)
+		}
+
+		*p = Pattern{raw: raw, re: re}
+		return nil
+	}
+
+	if _, err := path.Match(raw, ""); err != nil {
+		return fmt.Errorf("invalid glob %q: %w", raw, err)
+	}
+
+	if prefix := strings.TrimSuffix(raw, "*"); prefix != raw && !strings.ContainsAny(prefix, `*?[\`) {
+		*p = Pattern{raw: raw, prefix: &prefix}
+		return nil
+	}
+
+	*p = Pattern{raw: raw, glob: raw}
+	return nil
+}
@@ -0,0 +1,108 @@
+package rhythm
+
+import (
+	"testing"
+)
+
+func TestPattern(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern string
+		matches []string
+		rejects []string
+		invalid bool
+	}{
+		{
+			name:    "exact",
+			pattern: "loki",
+			matches: []string{"loki"},
+			rejects: []string{"loki-canary", "Loki", "grafana/loki"},
+		},
+		{
+			name:    "glob",
+			pattern: "loki-*-?",
+			matches: []string{"loki-canary-a", "loki--b"},
+			rejects: []string{"loki-canary", "loki-canary-ab", "loki-a/b-c"},
+		},
+		{
+			name:    "glob with class",
+			pattern: "area/[ab]*",
+			matches: []string{"area/a", "area/build"},
+			rejects: []string{"area/c", "area/a/b"},
+		},
+		{
+			name:    "trailing star spans slashes",
+			pattern: "area/*",
+			matches: []string{"area/", "area/logql", "area/a/b"},
+			rejects: []string{"area", "type/area/a"},
+		},
+		{
+			name:    "lone star matches everything",
+			pattern: "*",
+			matches: []string{"", "loki", "a/b"},
+		},
+		{
+			name:    "regex",
+			pattern: "/^loki-(canary|operator)$/",
+			matches: []string{"loki-canary", "loki-operator"},
+			rejects: []string{"loki", "loki-canary-2"},
+		},
+		{
+			name:    "unanchored regex",
+			pattern: "/bug/",
+			matches: []string{"bug", "type/bug", "bugfix"},
+			rejects: []string{"feature"},
+		},
+		{
+			name:    "single slash is a glob",
+			pattern: "/",
+			matches: []string{"/"},
+			rejects: []string{"", "a/"},
+		},
+		{
+			name:    "invalid regex",
+			pattern: "/loki-(/",
+			invalid: true,
+		},
+		{
+			name:    "invalid glob",
+			pattern: "loki-[",
+			invalid: true,
+		},
+		{
+			name:    "empty",
+			pattern: "",
+			invalid: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var p Pattern
+			err := p.UnmarshalText([]byte(tt.pattern))
+			if tt.invalid {
+				if err == nil {
+					t.Fatalf("expected %q to be invalid", tt.pattern)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if p.String() != tt.pattern {
+				t.Errorf("expected pattern to print as %q, got %q", tt.pattern, p.String())
+			}
+			for _, name := range tt.matches {
+				if !p.Match(name) {
+					t.Errorf("expected %q to match %q", tt.pattern, name)
+				}
+			}
+			for _, name := range tt.rejects {
+				if p.Match(name) {
+					t.Errorf("expected %q not to match %q", tt.pattern, name)
+				}
+			}
+		})
+	}
+}
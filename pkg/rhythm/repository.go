@@ -0,0 +1,63 @@
+package rhythm
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Repository identifies a single GitHub repository.
+// It is written as "owner/repo" in config files and flags.
+type Repository struct {
+	Owner string
+	Repo  string
+}
+
+func (r Repository) String() string {
+	return r.Owner + "/" + r.Repo
+}
+
+func (r Repository) MarshalText() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+func (r *Repository) UnmarshalText(text []byte) error {
+	owner, repo, ok := strings.Cut(string(text), "/")
+	if !ok || owner == "" || repo == "" || strings.Contains(repo, "/") {
+		return fmt.Errorf("invalid repository %q: expected owner/repo", text)
+	}
+
+	r.Owner = owner
+	r.Repo = repo
+	return nil
+}
+
+// repositoryList is a flag.Value holding a comma-separated list of repositories.
+// Setting it replaces any previous value, so that flags override lists from the config file.
+type repositoryList []Repository
+
+func (l *repositoryList) String() string {
+	if l == nil {
+		return ""
+	}
+
+	names := make([]string, 0, len(*l))
+	for _, r := range *l {
+		names = append(names, r.String())
+	}
+	return strings.Join(names, ",")
+}
+
+func (l *repositoryList) Set(val string) error {
+	var names stringList
+	_ = names.Set(val)
+
+	repos := make([]Repository, len(names))
+	for i, name := range names {
+		if err := repos[i].UnmarshalText([]byte(name)); err != nil {
+			return err
+		}
+	}
+
+	*l = repos
+	return nil
+}
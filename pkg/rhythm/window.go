@@ -0,0 +1,80 @@
+package rhythm
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Window is a rolling look-back period, e.g. "the last 30 days".
+// It is written as a number of days ("30d") or weeks ("2w"), as a Go duration ("12h"),
+// or as "all" for an unbounded window, which is represented by zero.
+type Window time.Duration
+
+// AllTime is the unbounded window.
+const AllTime Window = 0
+
+// Contains reports whether t falls within the window ending at now.
+func (w Window) Contains(t, now time.Time) bool {
+	if w == AllTime {
+		return true
+	}
+
+	return !t.Before(now.Add(-time.Duration(w)))
+}
+
+// Start returns the beginning of the window ending at now, or the zero time for an unbounded window.
+func (w Window) Start(now time.Time) time.Time {
+	if w == AllTime {
+		return time.Time{}
+	}
+
+	return now.Add(-time.Duration(w))
+}
+
+// String returns the window in the form used for labels, e.g. "30d".
+func (w Window) String() string {
+	d := time.Duration(w)
+	switch {
+	case w == AllTime:
+		return "all"
+	case d%(24*time.Hour) == 0:
+		return strconv.Itoa(int(d/(24*time.Hour))) + "d"
+	default:
+		return d.String()
+	}
+}
+
+func (w Window) MarshalText() ([]byte, error) {
+	return []byte(w.String()), nil
+}
+
+func (w *Window) UnmarshalText(text []byte) error {
+	s := strings.TrimSpace(string(text))
+
+	if s == "all" {
+		*w = AllTime
+		return nil
+	}
+
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if n, ok := strings.CutSuffix(s, suffix); ok {
+			count, err := strconv.Atoi(n)
+			if err != nil || count <= 0 {
+				return fmt.Errorf("invalid window %q", s)
+			}
+
+			*w = Window(time.Duration(count) * unit)
+			return nil
+		}
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return fmt.Errorf("invalid window %q: expected e.g. 30d, 2w, 12h or all", s)
+	}
+
+	*w = Window(d)
+	return nil
+}
@@ -0,0 +1,204 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/dannykopping/repo-rhythm/pkg/beats"
+	"github.com/dannykopping/repo-rhythm/pkg/rhythm"
+	"github.com/dannykopping/repo-rhythm/pkg/store"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Runner runs the configured beats against a changing set of repositories.
+// Each repository's beats are registered with the registerer while the repository is monitored,
+// and unregistered once it is no longer, so that its series are removed.
+type Runner struct {
+	cfg    *rhythm.Config
+	names  []string
+	exec   *beats.Executor
+	store  *store.Store
+	reg    prometheus.Registerer
+	logger log.Logger
+	sched  *scheduler
+
+	mu      sync.Mutex
+	targets map[rhythm.Repository]*target
+	wg      sync.WaitGroup
+}
+
+type target struct {
+	*beats.Target
+
+	beats  []beats.Beat
+	cancel context.CancelFunc
+	// wg tracks the target's running beats
+	wg sync.WaitGroup
+}
+
+// New creates a Runner for the beats with the given names, which must be valid.
+// The store may be nil, in which case nothing is persisted.
+func New(cfg *rhythm.Config, names []string, exec *beats.Executor, st *store.Store, reg prometheus.Registerer, logger log.Logger) *Runner {
+	return &Runner{
+		cfg:     cfg,
+		names:   names,
+		exec:    exec,
+		store:   st,
+		reg:     reg,
+		logger:  logger,
+		sched:   newScheduler(cfg),
+		targets: make(map[rhythm.Repository]*target),
+	}
+}
+
+// Sync starts monitoring any of the given repositories which are not yet monitored,
+// and stops monitoring those which are monitored but not given.
+// Beats are run until they are stopped by a later Sync, or until the given context is done.
+func (r *Runner) Sync(ctx context.Context, repos []rhythm.Repository) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	want := make(map[rhythm.Repository]struct{}, len(repos))
+	for _, repo := range repos {
+		want[repo] = struct{}{}
+	}
+
+	for repo, t := range r.targets {
+		if _, ok := want[repo]; ok {
+			continue
+		}
+
+		r.remove(t)
+		delete(r.targets, repo)
+	}
+
+	var errs []error
+	for repo := range want {
+		if _, ok := r.targets[repo]; ok {
+			continue
+		}
+
+		t, err := r.add(ctx, repo)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to monitor %s: %w", repo, err))
+			continue
+		}
+
+		r.targets[repo] = t
+	}
+
+	return errors.Join(errs...)
+}
+
+// Wait blocks until all beats have stopped, which happens once the context given to Sync is done.
+func (r *Runner) Wait() {
+	r.wg.Wait()
+}
+
+func (r *Runner) add(ctx context.Context, repo rhythm.Repository) (*target, error) {
+	t := &target{
+		Target: &beats.Target{
+			Repository: repo,
+			Exec:       r.exec,
+			Cache:      beats.NewCache(r.cfg, repo, r.exec, r.store),
+		},
+	}
+
+	for _, name := range r.names {
+		beat, err := beats.New(name)
+		if err != nil {
+			return nil, err
+		}
+
+		beat.Setup(r.cfg, t.Target)
+		if err := r.reg.Register(beat); err != nil {
+			// roll back the beats registered so far, so that the target can be retried cleanly
+			for _, b := range t.beats {
+				r.reg.Unregister(b)
+			}
+			return nil, err
+		}
+
+		t.beats = append(t.beats, beat)
+	}
+
+	level.Info(r.logger).Log("msg", "monitoring repository", "repository", repo)
+
+	ctx, t.cancel = context.WithCancel(ctx)
+	for i, beat := range t.beats {
+		r.wg.Add(1)
+		t.wg.Add(1)
+		go func(name string, beat beats.Beat) {
+			defer r.wg.Done()
+			defer t.wg.Done()
+			r.run(ctx, t, name, beat)
+		}(r.names[i], beat)
+	}
+
+	return t, nil
+}
+
+func (r *Runner) remove(t *target) {
+	t.cancel()
+	for _, beat := range t.beats {
+		r.reg.Unregister(beat)
+	}
+
+	level.Info(r.logger).Log("msg", "stopped monitoring repository", "repository", t.Repository)
+
+	if r.store != nil {
+		// beats which are still syncing the cache would persist it again after it was deleted
+		t.wg.Wait()
+
+		// the repository may well have been deleted or archived, so there is no point in holding on to its state
+		if err := r.store.Delete(t.Repository); err != nil {
+			level.Warn(r.logger).Log("msg", "failed to delete stored state", "repository", t.Repository, "err", err)
+		}
+	}
+}
+
+func (r *Runner) run(ctx context.Context, t *target, name string, beat beats.Beat) {
+	interval := r.sched.interval(name, beat)
+	log := log.With(r.logger, "beat", beat.Name(), "repository", t.Repository, "interval", interval)
+
+	timer := time.NewTimer(r.sched.initialDelay(interval))
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			level.Info(log).Log("msg", "beat stopped")
+			return
+		case <-timer.C:
+		}
+
+		if err := r.sched.acquire(ctx); err != nil {
+			level.Info(log).Log("msg", "beat stopped")
+			return
+		}
+
+		start := time.Now()
+		level.Info(log).Log("msg", "beat started")
+
+		err := beat.Tick(ctx, log)
+		r.sched.release()
+
+		if ctx.Err() != nil {
+			level.Info(log).Log("msg", "beat stopped")
+			return
+		}
+
+		if err != nil {
+			level.Warn(log).Log("msg", "beat failed", "err", err, "duration", time.Since(start))
+		} else {
+			level.Info(log).Log("msg", "beat succeeded", "duration", time.Since(start))
+		}
+
+		timer.Reset(r.sched.next(interval, start, time.Now()))
+	}
+}
@@ -0,0 +1,69 @@
+package runner
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"github.com/dannykopping/repo-rhythm/pkg/beats"
+	"github.com/dannykopping/repo-rhythm/pkg/rhythm"
+)
+
+// scheduler decides when beats tick, and limits how many can tick at once.
+type scheduler struct {
+	cfg *rhythm.Config
+	sem chan struct{}
+}
+
+func newScheduler(cfg *rhythm.Config) *scheduler {
+	return &scheduler{
+		cfg: cfg,
+		sem: make(chan struct{}, cfg.Scheduler.MaxConcurrentBeats),
+	}
+}
+
+// interval returns how often the named beat should tick. An interval set in config takes precedence over
+// the beat's own preference (see beats.WithTickInterval), which in turn takes precedence over the default.
+func (s *scheduler) interval(name string, beat beats.Beat) time.Duration {
+	if interval, ok := s.cfg.Scheduler.Intervals[name]; ok {
+		return interval
+	}
+
+	if b, ok := beat.(beats.WithTickInterval); ok && b.TickInterval() > 0 {
+		return b.TickInterval()
+	}
+
+	return s.cfg.TickInterval
+}
+
+// initialDelay spreads out the first ticks of beats started at the same time.
+func (s *scheduler) initialDelay(interval time.Duration) time.Duration {
+	return time.Duration(rand.Float64() * s.cfg.Scheduler.Jitter * float64(interval))
+}
+
+// next returns the delay until the following tick, given when the previous tick started.
+// Ticks are spaced by the interval plus or minus the jitter; a tick which overran the interval
+// is followed by the next immediately, so that ticks of the same beat never overlap.
+func (s *scheduler) next(interval time.Duration, start, now time.Time) time.Duration {
+	jitter := (rand.Float64()*2 - 1) * s.cfg.Scheduler.Jitter * float64(interval)
+
+	delay := start.Add(interval + time.Duration(jitter)).Sub(now)
+	if delay < 0 {
+		return 0
+	}
+	return delay
+}
+
+// acquire blocks until the beat is allowed to tick, or the context is done.
+func (s *scheduler) acquire(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case s.sem <- struct{}{}:
+		return nil
+	}
+}
+
+func (s *scheduler) release() {
+	<-s.sem
+}
@@ -0,0 +1,208 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/dannykopping/repo-rhythm/pkg/rhythm"
+	bolt "go.etcd.io/bbolt"
+)
+
+// SchemaVersion is the version of the store's layout. Stores written with a different version are wiped when opened,
+// since everything in them can be fetched again.
+const SchemaVersion = 1
+
+var NotFoundErr = errors.New("not found")
+
+var (
+	metaBucket  = []byte("meta")
+	versionKey  = []byte("schema_version")
+	reposBucket = []byte("repositories")
+)
+
+// openTimeout bounds how long to wait for another process to release its lock on the store.
+const openTimeout = 5 * time.Second
+
+// Store persists what is known about each repository to a file on disk,
+// so that a restart doesn't require everything to be fetched again.
+//
+// Values are JSON-encoded, and grouped into named buckets per repository.
+type Store struct {
+	db *bolt.DB
+}
+
+// Record is a single value to be saved to a bucket.
+type Record struct {
+	Bucket string
+	Key    string
+	Value  interface{}
+}
+
+// Open opens the store at the given path, creating it if it does not exist.
+// The store is wiped if it was written with a different schema version.
+func Open(path string) (*Store, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: openTimeout})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open store %q: %w", path, err)
+	}
+
+	s := &Store{db: db}
+	if err := s.migrate(); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+func (s *Store) migrate() error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		meta, err := tx.CreateBucketIfNotExists(metaBucket)
+		if err != nil {
+			return err
+		}
+
+		version, _ := strconv.Atoi(string(meta.Get(versionKey)))
+		if version != SchemaVersion {
+			if err := wipe(tx); err != nil {
+				return err
+			}
+		}
+
+		return meta.Put(versionKey, []byte(strconv.Itoa(SchemaVersion)))
+	})
+}
+
+// Wipe removes everything stored for all repositories.
+func (s *Store) Wipe() error {
+	return s.db.Update(wipe)
+}
+
+func wipe(tx *bolt.Tx) error {
+	if tx.Bucket(reposBucket) == nil {
+		return nil
+	}
+
+	return tx.DeleteBucket(reposBucket)
+}
+
+// Save writes the given records for a repository in a single transaction,
+// so that either all or none of them are saved.
+func (s *Store) Save(repo rhythm.Repository, records ...Record) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		for _, r := range records {
+			val, err := json.Marshal(r.Value)
+			if err != nil {
+				return fmt.Errorf("failed to encode %s/%s: %w", r.Bucket, r.Key, err)
+			}
+
+			b, err := createBucket(tx, repo, r.Bucket)
+			if err != nil {
+				return err
+			}
+
+			if err := b.Put([]byte(r.Key), val); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// Get decodes the value with the given key from a repository's bucket into v.
+// NotFoundErr is returned if there is no such value.
+func (s *Store) Get(repo rhythm.Repository, bucket, key string, v interface{}) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		b := getBucket(tx, repo, bucket)
+		if b == nil {
+			return NotFoundErr
+		}
+
+		val := b.Get([]byte(key))
+		if val == nil {
+			return NotFoundErr
+		}
+
+		return json.Unmarshal(val, v)
+	})
+}
+
+// ForEach calls fn with every key and value in a repository's bucket.
+// Values can be decoded with json.Unmarshal, but must not be retained after fn returns.
+func (s *Store) ForEach(repo rhythm.Repository, bucket string, fn func(key string, val []byte) error) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		b := getBucket(tx, repo, bucket)
+		if b == nil {
+			return nil
+		}
+
+		return b.ForEach(func(k, v []byte) error {
+			return fn(string(k), v)
+		})
+	})
+}
+
+// DeleteKeys removes the values with the given keys from a repository's bucket. Keys which don't exist are ignored.
+func (s *Store) DeleteKeys(repo rhythm.Repository, bucket string, keys ...string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := getBucket(tx, repo, bucket)
+		if b == nil {
+			return nil
+		}
+
+		for _, key := range keys {
+			if err := b.Delete([]byte(key)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Delete removes everything stored for a repository.
+func (s *Store) Delete(repo rhythm.Repository) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		repos := tx.Bucket(reposBucket)
+		if repos == nil || repos.Bucket([]byte(repo.String())) == nil {
+			return nil
+		}
+
+		return repos.DeleteBucket([]byte(repo.String()))
+	})
+}
+
+func getBucket(tx *bolt.Tx, repo rhythm.Repository, bucket string) *bolt.Bucket {
+	repos := tx.Bucket(reposBucket)
+	if repos == nil {
+		return nil
+	}
+
+	r := repos.Bucket([]byte(repo.String()))
+	if r == nil {
+		return nil
+	}
+
+	return r.Bucket([]byte(bucket))
+}
+
+func createBucket(tx *bolt.Tx, repo rhythm.Repository, bucket string) (*bolt.Bucket, error) {
+	repos, err := tx.CreateBucketIfNotExists(reposBucket)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := repos.CreateBucketIfNotExists([]byte(repo.String()))
+	if err != nil {
+		return nil, err
+	}
+
+	return r.CreateBucketIfNotExists([]byte(bucket))
+}